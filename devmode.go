@@ -0,0 +1,42 @@
+package starter
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// devWatcher watches the paths specified by DevWatch.
+// If they are changed, it runs the Build command and spawns a new worker if the build succeeds.
+func (s *Starter) devWatcher() {
+	watchFiles(s.ctx, s.DevWatch, s.watchDelay(), func(changed []string) {
+		s.logf("detected changes in %s", strings.Join(changed, ", "))
+		if !s.build() {
+			s.logf("keep running the current workers")
+			return
+		}
+		s.logf("spawning a new worker")
+		s.queueReload()
+	})
+}
+
+// build runs the Build command, and reports whether it succeeds.
+func (s *Starter) build() bool {
+	if s.Build == "" {
+		return true
+	}
+	s.logf("building: %s", s.Build)
+	cmd := exec.CommandContext(s.ctx, "sh", "-c", s.Build)
+	cmd.Dir = s.Dir
+	output, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			s.logf("build: %s", line)
+		}
+	}
+	if err != nil {
+		s.logf("build failed: %s", err)
+		return false
+	}
+	s.logf("build succeeded")
+	return true
+}
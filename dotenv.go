@@ -0,0 +1,184 @@
+package starter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// loadDotEnv reads the environment values from the file in dotenv format.
+func loadDotEnv(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	env, err := parseDotEnv(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return env, nil
+}
+
+// parseDotEnv parses the contents in dotenv format.
+//
+//	# comment
+//	export FOO=foo
+//	BAR="bar\nbaz" # double quoted values support escape sequences
+//	BAZ='raw value'
+func parseDotEnv(data string) ([]string, error) {
+	var env []string
+	p := dotEnvParser{data: data, line: 1}
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			break
+		}
+		switch p.peek() {
+		case '\n':
+			p.next()
+			continue
+		case '#':
+			p.skipLine()
+			continue
+		}
+
+		name := p.readName()
+		if name == "export" {
+			p.skipSpaces()
+			name = p.readName()
+		}
+		if name == "" {
+			return nil, p.errorf("invalid environment name")
+		}
+		p.skipSpaces()
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("missing '=' after %s", name)
+		}
+		p.next()
+		p.skipSpaces()
+		value, err := p.readValue()
+		if err != nil {
+			return nil, err
+		}
+
+		// the rest of the line must be a comment.
+		p.skipSpaces()
+		if !p.eof() && p.peek() != '\n' && p.peek() != '#' {
+			return nil, p.errorf("unexpected character %q", p.peek())
+		}
+		p.skipLine()
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
+
+type dotEnvParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *dotEnvParser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *dotEnvParser) peek() byte {
+	return p.data[p.pos]
+}
+
+func (p *dotEnvParser) next() byte {
+	c := p.data[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *dotEnvParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *dotEnvParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r') {
+		p.next()
+	}
+}
+
+func (p *dotEnvParser) skipLine() {
+	for !p.eof() {
+		if p.next() == '\n' {
+			return
+		}
+	}
+}
+
+func (p *dotEnvParser) readName() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '_' || c == '.' || c == '-' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' {
+			p.next()
+			continue
+		}
+		break
+	}
+	return p.data[start:p.pos]
+}
+
+func (p *dotEnvParser) readValue() (string, error) {
+	if p.eof() {
+		return "", nil
+	}
+	switch p.peek() {
+	case '\'':
+		// single quoted values are raw strings.
+		p.next()
+		start := p.pos
+		for !p.eof() {
+			if p.next() == '\'' {
+				return p.data[start : p.pos-1], nil
+			}
+		}
+		return "", p.errorf("unterminated single quoted value")
+	case '"':
+		// double quoted values support escape sequences.
+		p.next()
+		var b strings.Builder
+		for !p.eof() {
+			c := p.next()
+			switch c {
+			case '"':
+				return b.String(), nil
+			case '\\':
+				if p.eof() {
+					break
+				}
+				switch c := p.next(); c {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(c)
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", p.errorf("unterminated double quoted value")
+	}
+
+	// unquoted values end at the end of line or a comment.
+	// the spaces before the value are already skipped, so "FOO= # comment" is an empty value.
+	start := p.pos
+	for !p.eof() && p.peek() != '\n' {
+		if p.peek() == '#' && p.pos > 0 && (p.data[p.pos-1] == ' ' || p.data[p.pos-1] == '\t') {
+			break
+		}
+		p.next()
+	}
+	return strings.TrimRight(p.data[start:p.pos], " \t\r"), nil
+}
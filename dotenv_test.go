@@ -0,0 +1,51 @@
+package starter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	env, err := parseDotEnv(`# comment
+FOO=foo
+export BAR = bar baz # comment
+EMPTY=
+EMPTY_COMMENT= # comment
+HASH=foo#bar
+LEADING_HASH=#foo
+SINGLE='raw \n value'
+DOUBLE="escaped\n\"value\"" # comment
+MULTILINE="first
+second"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"FOO=foo",
+		"BAR=bar baz",
+		"EMPTY=",
+		"EMPTY_COMMENT=",
+		"HASH=foo#bar",
+		"LEADING_HASH=#foo",
+		`SINGLE=raw \n value`,
+		"DOUBLE=escaped\n\"value\"",
+		"MULTILINE=first\nsecond",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("want %#v, got %#v", want, env)
+	}
+
+	invalid := []string{
+		"FOO",
+		"=foo",
+		`FOO="unterminated`,
+		`FOO='unterminated`,
+		`FOO="foo" bar`,
+	}
+	for _, data := range invalid {
+		if _, err := parseDotEnv(data); err == nil {
+			t.Errorf("%q: want error, got nil", data)
+		}
+	}
+}
@@ -2,31 +2,45 @@ package starter
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
-func loadEnv(dir string) []string {
-	env := []string{}
-
-	// ignore errors
+// loadEnv reads the environment values from the directory in the same manner as envdir of daemontools.
+// It returns the values to be set and the names to be removed.
+//
+// The value is the first line of the file, trailing spaces and tabs are removed and NUL bytes are changed to newlines.
+// If the file is empty, the variable is removed.
+// The errors are reported, but the values that are read successfully are still returned.
+func loadEnv(dir string) (env []string, unset []string, err error) {
+	env = []string{}
 	if dir == "" {
-		return env
+		return env, nil, nil
 	}
 	stat, err := os.Stat(dir)
-	if err != nil || !stat.IsDir() {
-		return env
+	if err != nil {
+		return env, nil, err
+	}
+	if !stat.IsDir() {
+		return env, nil, fmt.Errorf("%s is not a directory", dir)
 	}
 
+	var errs errorList
 	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
-		// ignore errors
 		if err != nil {
+			errs = append(errs, err)
 			return nil
 		}
 
 		// skip sub directories.
-		if fi.IsDir() && !os.SameFile(stat, fi) {
+		if fi.IsDir() {
+			if os.SameFile(stat, fi) {
+				return nil
+			}
 			return filepath.SkipDir
 		}
 
@@ -35,20 +49,191 @@ func loadEnv(dir string) []string {
 			return nil
 		}
 
-		f, err := os.Open(path)
+		name := filepath.Base(path)
+		if strings.IndexByte(name, '=') >= 0 {
+			errs = append(errs, fmt.Errorf("%s: invalid environment name", path))
+			return nil
+		}
+		if fi.Size() == 0 {
+			unset = append(unset, name)
+			return nil
+		}
+		value, err := readEnvFile(path)
 		if err != nil {
+			errs = append(errs, err)
 			return nil
 		}
-		defer f.Close()
+		env = append(env, name+"="+value)
+		return nil
+	})
 
-		name := filepath.Base(path)
-		scanner := bufio.NewScanner(f)
-		if scanner.Scan() {
-			value := scanner.Text()
-			env = append(env, name+"="+value)
+	if len(errs) > 0 {
+		return env, unset, errs
+	}
+	return env, unset, nil
+}
+
+func readEnvFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimRight(line, " \t")
+	line = strings.Replace(line, "\x00", "\n", -1)
+	return line, nil
+}
+
+// mergeEnv sets the values env and removes the names unset from the environment values base.
+func mergeEnv(base, env, unset []string) []string {
+	remove := make(map[string]struct{}, len(env)+len(unset))
+	for _, name := range unset {
+		remove[name] = struct{}{}
+	}
+	for _, kv := range env {
+		if idx := strings.IndexByte(kv, '='); idx >= 0 {
+			remove[kv[:idx]] = struct{}{}
 		}
-		return nil
+	}
+
+	merged := make([]string, 0, len(base)+len(env))
+	for _, kv := range base {
+		name := kv
+		if idx := strings.IndexByte(kv, '='); idx >= 0 {
+			name = kv[:idx]
+		}
+		if _, ok := remove[name]; ok {
+			continue
+		}
+		merged = append(merged, kv)
+	}
+	return append(merged, env...)
+}
+
+// buildEnv builds the environment values of the server process.
+// The precedence order from lowest to highest is:
+//
+//  1. the environment values of start_server (only PassEnv if ClearEnv is set)
+//  2. EnvFiles, in the order specified
+//  3. EnvDir
+//  4. Env
+//  5. the values that start_server sets, such as SERVER_STARTER_PORT
+//
+// It returns an error if one of EnvFiles is broken,
+// because the server process may not work without the values in it.
+func (s *Starter) buildEnv(vars []string) ([]string, error) {
+	var env []string
+	if s.ClearEnv {
+		for _, name := range s.PassEnv {
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+	} else {
+		env = os.Environ()
+	}
+
+	for _, path := range s.EnvFiles {
+		values, err := loadDotEnv(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load env file %s: %s", path, err)
+		}
+		env = mergeEnv(env, values, nil)
+	}
+
+	envdir, unset, err := loadEnv(s.EnvDir)
+	if err != nil {
+		s.logf("failed to load envdir %s: %s", s.EnvDir, err)
+	}
+	env = mergeEnv(env, envdir, unset)
+	env = mergeEnv(env, s.Env, nil)
+	return mergeEnv(env, vars, nil), nil
+}
+
+// secretWords are the words in the names of the environment values that should not be logged.
+var secretWords = []string{"SECRET", "PASSWORD", "PASSWD", "TOKEN", "KEY", "CREDENTIAL", "PRIVATE", "AUTH"}
+
+func isSecretEnv(name string) bool {
+	name = strings.ToUpper(name)
+	for _, word := range secretWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// envToMap converts the environment values into the map.
+// the values that start_server sets for each generation are excluded.
+func envToMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		idx := strings.IndexByte(kv, '=')
+		if idx < 0 {
+			continue
+		}
+		name := kv[:idx]
+		switch name {
+		case PortEnvName, PortNamesEnvName, GenerationEnvName, HeartbeatEnvName:
+			continue
+		}
+		m[name] = kv[idx+1:]
+	}
+	return m
+}
+
+// diffEnv returns the differences between the environment values for logging.
+// The values of secret-looking names are redacted.
+func diffEnv(old, new map[string]string) []string {
+	format := func(name, value string) string {
+		if isSecretEnv(name) {
+			return name + "=<redacted>"
+		}
+		return name + "=" + value
+	}
+
+	var diff []string
+	for name, value := range new {
+		if oldValue, ok := old[name]; !ok {
+			diff = append(diff, "+"+format(name, value))
+		} else if oldValue != value {
+			diff = append(diff, "~"+format(name, value))
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			diff = append(diff, "-"+name)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i][1:] < diff[j][1:]
 	})
+	return diff
+}
 
-	return env
+// logEnvDiff logs the differences between the environment values of the generation and the previous one.
+func (s *Starter) logEnvDiff(generation int, env []string) {
+	m := envToMap(env)
+	old := s.lastEnv
+	s.lastEnv = m
+	if old == nil {
+		return
+	}
+	if diff := diffEnv(old, m); len(diff) > 0 {
+		s.logf("environment changes in generation %d: %s", generation, strings.Join(diff, ", "))
+	}
+}
+
+// envDirWatcher watches EnvDir, and reloads the workers if it is changed.
+func (s *Starter) envDirWatcher() {
+	watchFiles(s.ctx, []string{s.EnvDir}, s.watchDelay(), func(changed []string) {
+		s.logf("detected changes in %s, spawning a new worker", strings.Join(changed, ", "))
+		s.queueReload()
+	})
 }
@@ -0,0 +1,152 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLoadEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"FOO":     " foo \t\nsecond line will be ignored.\n",
+		"NUL":     "foo\x00bar\n",
+		"EMPTY":   "\n",
+		"REMOVED": "",
+		".hidden": "hidden",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env, unset, err := loadEnv(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(env)
+	wantEnv := []string{"EMPTY=", "FOO= foo", "NUL=foo\nbar"}
+	if !reflect.DeepEqual(env, wantEnv) {
+		t.Errorf("want %#v, got %#v", wantEnv, env)
+	}
+	wantUnset := []string{"REMOVED"}
+	if !reflect.DeepEqual(unset, wantUnset) {
+		t.Errorf("want %#v, got %#v", wantUnset, unset)
+	}
+
+	merged := mergeEnv([]string{"FOO=inherited", "REMOVED=inherited", "PATH=/bin"}, env, unset)
+	wantMerged := []string{"PATH=/bin", "EMPTY=", "FOO= foo", "NUL=foo\nbar"}
+	if !reflect.DeepEqual(merged, wantMerged) {
+		t.Errorf("want %#v, got %#v", wantMerged, merged)
+	}
+
+	if _, _, err := loadEnv(filepath.Join(dir, "not-found")); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestDiffEnv(t *testing.T) {
+	old := envToMap([]string{
+		"FOO=foo",
+		"BAR=bar",
+		"REMOVED=removed",
+		"API_TOKEN=old-token",
+		PortEnvName + "=0.0.0.0:80=3",
+		GenerationEnvName + "=1",
+	})
+	new := envToMap([]string{
+		"FOO=foo",
+		"BAR=baz",
+		"ADDED=added",
+		"API_TOKEN=new-token",
+		"DB_PASSWORD=password",
+		PortEnvName + "=0.0.0.0:80=3",
+		GenerationEnvName + "=2",
+	})
+	got := diffEnv(old, new)
+	want := []string{
+		"+ADDED=added",
+		"~API_TOKEN=<redacted>",
+		"~BAR=baz",
+		"+DB_PASSWORD=<redacted>",
+		"-REMOVED",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestBuildEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, ".env")
+	if err := ioutil.WriteFile(envFile, []byte("FROM_FILE=file\nOVERRIDDEN=file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	envdir := filepath.Join(dir, "envdir")
+	if err := os.Mkdir(envdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(envdir, "OVERRIDDEN"), []byte("envdir\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("SERVER_STARTER_TEST_PASS", "pass")
+	os.Setenv("SERVER_STARTER_TEST_BLOCK", "block")
+	defer os.Unsetenv("SERVER_STARTER_TEST_PASS")
+	defer os.Unsetenv("SERVER_STARTER_TEST_BLOCK")
+
+	s := &Starter{
+		ClearEnv: true,
+		PassEnv:  []string{"SERVER_STARTER_TEST_PASS"},
+		EnvFiles: []string{envFile},
+		EnvDir:   envdir,
+		Env:      []string{"FROM_OPTION=option", GenerationEnvName + "=0"},
+	}
+	got, err := s.buildEnv([]string{GenerationEnvName + "=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"SERVER_STARTER_TEST_PASS=pass",
+		"FROM_FILE=file",
+		"OVERRIDDEN=envdir",
+		"FROM_OPTION=option",
+		GenerationEnvName + "=1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %#v, got %#v", want, got)
+	}
+}
+
+func TestBuildEnv_BrokenEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, ".env")
+	if err := ioutil.WriteFile(envFile, []byte("FOO=\"unterminated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Starter{
+		EnvFiles: []string{envFile},
+	}
+	if _, err := s.buildEnv(nil); err == nil {
+		t.Error("want error, got nil")
+	}
+}
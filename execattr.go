@@ -0,0 +1,159 @@
+package starter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// execAttrEnvName is the environment variable that passes the attributes of the server process
+// to the pre-exec helper.
+const execAttrEnvName = "SERVER_STARTER_EXEC_ATTR"
+
+// execAttr is the attributes that the pre-exec helper applies to itself
+// before it executes the server program.
+// the helper is start_server itself, so the attributes are applied without
+// changing the attributes of start_server, and the server process keeps the process id of the helper.
+type execAttr struct {
+	// the path of the server program.
+	Path string `json:"path"`
+
+	// the file descriptor to report the failure of applying the attributes.
+	ErrorFD int `json:"error_fd"`
+
+	// the resource limits.
+	Rlimits []Rlimit `json:"rlimits,omitempty"`
+
+	// the scheduling attributes.
+	Nice        *int  `json:"nice,omitempty"`
+	OOMScoreAdj *int  `json:"oom_score_adj,omitempty"`
+	CPUAffinity []int `json:"cpu_affinity,omitempty"`
+
+	// the umask.
+	Umask *int `json:"umask,omitempty"`
+}
+
+// execAttrError is the error that the pre-exec helper reports.
+// it is not worth retrying to start the server process.
+type execAttrError struct {
+	msg string
+}
+
+func (e *execAttrError) Error() string {
+	return e.msg
+}
+
+func init() {
+	// the init function of the starter package runs before the main function of start_server,
+	// and before the test functions of the package.
+	if data, ok := os.LookupEnv(execAttrEnvName); ok {
+		execWithAttr(data)
+	}
+}
+
+// execWithAttr applies the attributes, and executes the server program.
+// it never returns.
+func execWithAttr(data string) {
+	var attr execAttr
+	if err := json.Unmarshal([]byte(data), &attr); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", execAttrEnvName, err)
+		os.Exit(127)
+	}
+	fail := func(err error) {
+		syscall.Write(attr.ErrorFD, []byte(err.Error()))
+		os.Exit(127)
+	}
+
+	// some attributes are the attributes of threads,
+	// so apply them to the thread that executes the server program.
+	runtime.LockOSThread()
+
+	if err := setRlimits(attr.Rlimits); err != nil {
+		fail(err)
+	}
+	if err := setProcAttr(&attr); err != nil {
+		fail(err)
+	}
+	if attr.Umask != nil {
+		syscall.Umask(*attr.Umask)
+	}
+
+	env := os.Environ()
+	for i, v := range env {
+		if strings.HasPrefix(v, execAttrEnvName+"=") {
+			env = append(env[:i], env[i+1:]...)
+			break
+		}
+	}
+
+	// the error pipe is closed by exec, and it tells start_server that the attributes are applied.
+	syscall.CloseOnExec(attr.ErrorFD)
+	err := syscall.Exec(attr.Path, os.Args, env)
+
+	// the failure of exec is same as the failure of the server program,
+	// so it is not reported via the error pipe.
+	fmt.Fprintf(os.Stderr, "failed to exec %s: %s\n", attr.Path, err)
+	os.Exit(127)
+}
+
+// needsExecAttr returns whether the server processes need the pre-exec helper.
+func (s *Starter) needsExecAttr() bool {
+	return len(s.Rlimits) > 0 || s.Nice != nil || s.OOMScoreAdj != nil || len(s.CPUAffinity) > 0 || s.Umask != nil
+}
+
+// startCommand starts the server process.
+// if some attributes are applied to the server process, it starts the pre-exec helper,
+// and waits for the helper to execute the server program.
+func (s *Starter) startCommand(cmd *exec.Cmd) error {
+	if !s.needsExecAttr() {
+		return cmd.Start()
+	}
+
+	self, err := selfExecutable()
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	attr := execAttr{
+		Path:    cmd.Path,
+		ErrorFD: len(cmd.ExtraFiles) + 3,
+		Rlimits: s.Rlimits,
+
+		Nice:        s.Nice,
+		OOMScoreAdj: s.OOMScoreAdj,
+		CPUAffinity: s.CPUAffinity,
+		Umask:       s.Umask,
+	}
+	data, err := json.Marshal(attr)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	cmd.Path = self
+	cmd.ExtraFiles = append(cmd.ExtraFiles[:len(cmd.ExtraFiles):len(cmd.ExtraFiles)], w)
+	cmd.Env = append(cmd.Env, execAttrEnvName+"="+string(data))
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	// wait for exec or exit of the helper.
+	msg, err := ioutil.ReadAll(r)
+	if err != nil || len(msg) == 0 {
+		return nil
+	}
+	cmd.Wait()
+	return &execAttrError{msg: string(msg)}
+}
@@ -0,0 +1,384 @@
+package starter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// handoverVersion is the version of the handover protocol.
+//
+// The protocol is line based. The client is the new start_server, and the server is the running one.
+//
+//	C: HELLO 1
+//	S: HELLO 1
+//	C: SOCKETS
+//	S: SOCKETS ["--port=80","--path=/tmp/app.sock"]  (with the file descriptors in SCM_RIGHTS, in the same order)
+//	   ... the file descriptors may be split into some messages, see writeLineWithFDs ...
+//	   ... the client starts its first generation ...
+//	C: DRAIN
+//	S: DRAINING
+//	   ... the server stops its server processes and exits ...
+//
+// The server replies "ERROR message" if it fails.
+const handoverVersion = 1
+
+// the maximum time to wait for a reply of the handover protocol.
+const handoverTimeout = 10 * time.Second
+
+// the maximum number of file descriptors in a SCM_RIGHTS message, SCM_MAX_FD of Linux.
+const handoverMaxFDs = 253
+
+// handoverConn is a connection of the handover protocol.
+type handoverConn struct {
+	conn *net.UnixConn
+	r    *bufio.Reader
+}
+
+func newHandoverConn(conn *net.UnixConn) *handoverConn {
+	return &handoverConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+}
+
+func (c *handoverConn) writeLine(format string, args ...interface{}) error {
+	c.conn.SetWriteDeadline(time.Now().Add(handoverTimeout))
+	_, err := fmt.Fprintf(c.conn, format+"\n", args...)
+	return err
+}
+
+// readLine reads a line and splits it into the command and the argument.
+func (c *handoverConn) readLine() (string, string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	cmd, arg := line, ""
+	if idx := strings.IndexByte(line, ' '); idx >= 0 {
+		cmd, arg = line[:idx], line[idx+1:]
+	}
+	if cmd == "ERROR" {
+		return "", "", errors.New(arg)
+	}
+	return cmd, arg, nil
+}
+
+// expect reads a line and checks its command.
+func (c *handoverConn) expect(want string) (string, error) {
+	cmd, arg, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	if cmd != want {
+		return "", fmt.Errorf("%s is expected, got %s", want, cmd)
+	}
+	return arg, nil
+}
+
+// writeLineWithFDs writes a line, and attaches the file descriptors to it.
+// the file descriptors are sent in batches, each batch is attached to a part of the line.
+func (c *handoverConn) writeLineWithFDs(line []byte, fds []int) error {
+	c.conn.SetWriteDeadline(time.Now().Add(handoverTimeout))
+	for {
+		n := len(fds)
+		if n > handoverMaxFDs {
+			n = handoverMaxFDs
+		}
+		// a line has at least one byte for each batch, because the line describes the sockets.
+		data := line
+		if n < len(fds) && len(line) > 1 {
+			data = line[:1]
+		}
+		var oob []byte
+		if n > 0 {
+			oob = syscall.UnixRights(fds[:n]...)
+		}
+		if _, _, err := c.conn.WriteMsgUnix(data, oob, nil); err != nil {
+			return err
+		}
+		line, fds = line[len(data):], fds[n:]
+		if len(line) == 0 {
+			break
+		}
+	}
+	if len(fds) > 0 {
+		return errors.New("too many file descriptors for the line")
+	}
+	return nil
+}
+
+// readLineWithFDs reads a line, and the file descriptors attached to it.
+func (c *handoverConn) readLineWithFDs() ([]byte, []*os.File, error) {
+	var line []byte
+	var files []*os.File
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, syscall.CmsgSpace(handoverMaxFDs*4))
+	for len(line) == 0 || line[len(line)-1] != '\n' {
+		n, oobn, flags, _, err := c.conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, err
+		}
+		fds, err := parseUnixRights(oob[:oobn])
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "handover"))
+		}
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, err
+		}
+		if flags&syscall.MSG_CTRUNC != 0 {
+			closeFiles(files)
+			return nil, nil, errors.New("some file descriptors are truncated")
+		}
+		if n == 0 {
+			closeFiles(files)
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		line = append(line, buf[:n]...)
+	}
+	return line, files, nil
+}
+
+func (c *handoverConn) Close() error {
+	return c.conn.Close()
+}
+
+// listenHandover starts to accept the start_servers that take over the sockets.
+func (s *Starter) listenHandover() error {
+	path := s.HandoverSocket
+	if stat, err := os.Lstat(path); err == nil && stat.Mode()&os.ModeSocket != os.ModeSocket {
+		return fmt.Errorf("%s: not a socket file", path)
+	}
+
+	// only the same user can take over the sockets.
+	// listenUnix sets the permission before the socket file appears on the path.
+	sock, err := s.listenUnix(&unixPath{network: "unix", path: path, mode: 0600, uid: -1, gid: -1})
+	if err != nil {
+		return err
+	}
+	l := sock.(*net.UnixListener)
+	stat, err := os.Lstat(path)
+	if err != nil {
+		l.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	s.handoverListener = l
+	s.handoverStat = stat
+	s.mu.Unlock()
+	go func() {
+		for {
+			conn, err := l.AcceptUnix()
+			if err != nil {
+				return
+			}
+			s.serveHandover(newHandoverConn(conn))
+		}
+	}()
+	return nil
+}
+
+// closeHandover stops accepting the start_servers.
+func (s *Starter) closeHandover() {
+	s.mu.Lock()
+	l, stat := s.handoverListener, s.handoverStat
+	s.handoverListener, s.handoverStat = nil, nil
+	s.mu.Unlock()
+	if l == nil {
+		return
+	}
+	l.Close()
+	if cur, err := os.Lstat(s.HandoverSocket); err == nil && os.SameFile(cur, stat) {
+		os.Remove(s.HandoverSocket)
+	}
+}
+
+// serveHandover hands over the sockets to the new start_server.
+func (s *Starter) serveHandover(c *handoverConn) {
+	defer c.Close()
+	c.conn.SetReadDeadline(time.Now().Add(handoverTimeout))
+
+	arg, err := c.expect("HELLO")
+	if err != nil {
+		s.logf("handover: %s", err)
+		return
+	}
+	if arg != strconv.Itoa(handoverVersion) {
+		c.writeLine("ERROR unsupported version: %s", arg)
+		return
+	}
+	c.writeLine("HELLO %d", handoverVersion)
+
+	if _, err := c.expect("SOCKETS"); err != nil {
+		s.logf("handover: %s", err)
+		return
+	}
+	if s.shutdown.IsSet() || !s.tryToLockReload() {
+		c.writeLine("ERROR start_server is busy, try again later")
+		return
+	}
+	s.handoverPending.Set(true)
+	if err := s.sendSockets(c); err != nil {
+		s.logf("handover: failed to send the sockets: %s", err)
+		s.abortHandover()
+		return
+	}
+	s.logf("handover: sent the sockets, waiting for the new start_server to start")
+
+	// the new start_server may take a while to start its first generation, but not forever.
+	c.conn.SetReadDeadline(time.Now().Add(upgradeTimeout))
+	if _, err := c.expect("DRAIN"); err != nil {
+		s.logf("handover: the new start_server has given up or doesn't get ready in %s: %s", upgradeTimeout, err)
+		s.abortHandover()
+		return
+	}
+
+	// the new start_server will listen on the handover socket.
+	s.closeHandover()
+	c.writeLine("DRAINING")
+	c.Close()
+	s.handOver()
+}
+
+func (s *Starter) sendSockets(c *handoverConn) error {
+	s.mu.RLock()
+	sockets := s.listenSockets
+	s.mu.RUnlock()
+
+	opts := make([]string, 0, len(sockets))
+	files := make([]*os.File, 0, len(sockets))
+	defer func() {
+		closeFiles(files)
+	}()
+	fds := make([]int, 0, len(sockets))
+	for _, ls := range sockets {
+		f, err := ls.sock.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		fds = append(fds, int(f.Fd()))
+		opts = append(opts, ls.opt.key())
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	line := append([]byte("SOCKETS "), data...)
+	line = append(line, '\n')
+	return c.writeLineWithFDs(line, fds)
+}
+
+// abortHandover gives up the handover, and enables reloading again.
+func (s *Starter) abortHandover() {
+	s.handoverPending.Set(false)
+	s.unlockReload()
+}
+
+// takeover receives the sockets from the running start_server.
+// The connection is kept until the first generation starts, see drainOld.
+func (s *Starter) takeover() error {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: s.Takeover, Net: "unix"})
+	if err != nil {
+		// there is no start_server to take over from, e.g. the first deployment.
+		s.logf("handover: no start_server to take over the sockets from: %s", err)
+		return nil
+	}
+	c := newHandoverConn(conn)
+
+	c.conn.SetReadDeadline(time.Now().Add(handoverTimeout))
+	if err := c.writeLine("HELLO %d", handoverVersion); err != nil {
+		c.Close()
+		return err
+	}
+	if _, err := c.expect("HELLO"); err != nil {
+		c.Close()
+		return fmt.Errorf("handover: %v", err)
+	}
+	if err := c.writeLine("SOCKETS"); err != nil {
+		c.Close()
+		return err
+	}
+
+	// the file descriptors are attached to the reply.
+	line, files, err := c.readLineWithFDs()
+	if err != nil {
+		c.Close()
+		return err
+	}
+	defer closeFiles(files)
+
+	c.r = bufio.NewReader(io.MultiReader(bytes.NewReader(line), c.conn))
+	arg, err := c.expect("SOCKETS")
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("handover: %v", err)
+	}
+	var opts []string
+	if err := json.Unmarshal([]byte(arg), &opts); err != nil {
+		c.Close()
+		return fmt.Errorf("handover: invalid reply: %v", err)
+	}
+	if len(opts) != len(files) {
+		c.Close()
+		return fmt.Errorf("handover: %d sockets are expected, got %d", len(opts), len(files))
+	}
+
+	s.inheritedSockets = make(map[string]socket, len(opts))
+	for i, opt := range opts {
+		sock, err := fileSocket(files[i])
+		if err != nil {
+			c.Close()
+			return fmt.Errorf("%s: %v", opt, err)
+		}
+		s.inheritedSockets[opt] = sock
+	}
+	s.logf("handover: received %d sockets from %s", len(opts), s.Takeover)
+	s.takeoverConn = c
+	return nil
+}
+
+func parseUnixRights(oob []byte) ([]int, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	for _, msg := range msgs {
+		rights, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			return nil, err
+		}
+		fds = append(fds, rights...)
+	}
+	return fds, nil
+}
+
+// drainOld tells the old start_server to stop its server processes and exit.
+func (s *Starter) drainOld() error {
+	c := s.takeoverConn
+	s.takeoverConn = nil
+	defer c.Close()
+	c.conn.SetReadDeadline(time.Now().Add(handoverTimeout))
+	if err := c.writeLine("DRAIN"); err != nil {
+		return err
+	}
+	if _, err := c.expect("DRAINING"); err != nil {
+		return err
+	}
+	s.logf("handover: the old start_server is draining")
+	return nil
+}
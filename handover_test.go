@@ -0,0 +1,60 @@
+package starter
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestHandoverConn_LineWithFDs(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newConn := func(fd int) *handoverConn {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		defer f.Close()
+		conn, err := net.FileConn(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newHandoverConn(conn.(*net.UnixConn))
+	}
+	c1 := newConn(fds[0])
+	defer c1.Close()
+	c2 := newConn(fds[1])
+	defer c2.Close()
+
+	// more file descriptors than a SCM_RIGHTS message can carry.
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sent := make([]int, 2*handoverMaxFDs+10)
+	for i := range sent {
+		sent[i] = int(f.Fd())
+	}
+	want := "SOCKETS " + strings.Repeat("x", 1000) + "\n"
+
+	chErr := make(chan error, 1)
+	go func() {
+		chErr <- c1.writeLineWithFDs([]byte(want), sent)
+	}()
+	line, files, err := c2.readLineWithFDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFiles(files)
+	if err := <-chErr; err != nil {
+		t.Fatal(err)
+	}
+	if string(line) != want {
+		t.Errorf("want %q, got %q", want, line)
+	}
+	if len(files) != len(sent) {
+		t.Errorf("want %d files, got %d", len(sent), len(files))
+	}
+}
@@ -0,0 +1,77 @@
+package starter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HeartbeatEnvName is the environment name for the path of the heartbeat file.
+// The server process should touch the file every HeartbeatInterval.
+const HeartbeatEnvName = "SERVER_STARTER_HEARTBEAT_FILE"
+
+// openHeartbeatDir creates the directory for the heartbeat files.
+func (s *Starter) openHeartbeatDir() error {
+	if s.HeartbeatInterval <= 0 {
+		return nil
+	}
+	dir, err := ioutil.TempDir("", "server-starter")
+	if err != nil {
+		return err
+	}
+	s.heartbeatDir = dir
+	return nil
+}
+
+// createHeartbeatFile creates the heartbeat file for the generation.
+func (s *Starter) createHeartbeatFile(generation int) (string, error) {
+	if s.heartbeatDir == "" {
+		return "", nil
+	}
+	path := filepath.Join(s.heartbeatDir, fmt.Sprintf("heartbeat.%d", generation))
+	if err := ioutil.WriteFile(path, []byte{}, 0666); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// heartbeatWatcher watches the heartbeat file of the newest generation,
+// and reloads the workers if the worker misses HeartbeatMisses heartbeats.
+func (s *Starter) heartbeatWatcher() {
+	interval := s.HeartbeatInterval
+	misses := s.heartbeatMisses()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		w := s.newestWorker()
+		if w == nil || w.heartbeatFile == "" {
+			continue
+		}
+		stat, err := os.Stat(w.heartbeatFile)
+		if err != nil {
+			continue // the worker may have exited
+		}
+		if n := int(time.Since(stat.ModTime()) / interval); n >= misses {
+			// if another reload is in progress, Reload does nothing
+			// and the worker is checked again at the next tick.
+			s.logf("worker %d missed %d heartbeats, spawning a new worker", w.Pid(), n)
+			go s.Reload()
+		}
+	}
+}
+
+func (s *Starter) heartbeatMisses() int {
+	if s.HeartbeatMisses > 0 {
+		return s.HeartbeatMisses
+	}
+	return 3
+}
@@ -20,9 +20,29 @@ func showHelp() {
 		"    If host is not specified, then the program will bind to the default address of IPv4 (\"0.0.0.0\").\n",
 		"    Square brackets should be used to specify an IPv6 address (e.g. --port=[::1]:8080)\n",
 		"    The command binds to UDP ports if the port numbers are prefixed by \"u\" (e.g., --port=u443).\n",
+		"    A range of ports binds each of them (e.g., --port=8000-8015, --port=u5000-5003),\n",
+		"    and a host name binds all the addresses that it resolves to.\n",
+		"    The sockets of --port and --path can be named by the prefix \"name@\" (e.g., --port=admin@127.0.0.1:9000),\n",
+		"    and the names are passed to the command in SERVER_STARTER_PORT_NAMES (e.g., admin=3;web=4).\n",
+		"    The socket options can be set by the query (e.g., --port=0.0.0.0:443?reuseport&fastopen=256&v6only=1&rcvbuf=4M).\n",
+		"    The options are reuseport, nodelay, keepalive, fastopen=queue-length, defer-accept=seconds,\n",
+		"    v6only, rcvbuf=size and sndbuf=size. nodelay, keepalive, fastopen and defer-accept are for TCP only,\n",
+		"    and fastopen and defer-accept are supported only on Linux.\n",
 		"\n",
 		"  --path=path:\n",
 		"    path at where to listen using unix socket (optional)\n",
+		"    The permission and the owner of the socket file can be set by the query (e.g., --path=/tmp/app.sock?mode=0660&owner=app&group=www).\n",
+		"    The socket file is created with them at once, so clients never see it with the wrong permission.\n",
+		"    The query starts at the last \"?\", so a path that contains \"?\" needs a trailing \"?\" (e.g., --path=/tmp/app?.sock?).\n",
+		"    A relative path that contains \"@\" is read as \"name@path\" (e.g., --path=app@1.sock binds 1.sock named app),\n",
+		"    so prefix it by \"./\" to bind the file itself (e.g., --path=./app@1.sock).\n",
+		"    The path prefixed by \"@\" is an abstract unix socket on Linux (e.g., --path=@app.sock), which has no socket file.\n",
+		"    The socket type can be prefixed by \"unixgram:\" or \"unixpacket:\" (e.g., --path=unixgram:/tmp/log.sock).\n",
+		"\n",
+		"  --listen-file=file:\n",
+		"    file that contains additional --port=... and --path=... options, one option per line (optional)\n",
+		"    The file is read again when start_server receives HUP. The sockets newly added are bound,\n",
+		"    and the sockets removed are closed after no worker uses them.\n",
 		"\n",
 		"  --dir=path\n",
 		"    working directory, start_server do chdir to before exec (optional)\n",
@@ -40,6 +60,33 @@ func showHelp() {
 		"  --signal-on-term=SIGNAL\n",
 		"    name of the signal to be sent to the server process when start_server receives a SIGTERM (default: SIGTERM).\n",
 		"\n",
+		"  --forward-signal=SIGNAL1,SIGNAL2,...\n",
+		"    names of the signals to be relayed to the server process of the newest generation as is.\n",
+		"    HUP, INT, TERM and QUIT cannot be forwarded. USR1 also reopens the log file.\n",
+		"    This option can be specified multiple times.\n",
+		"\n",
+		"  --upgrade-signal=SIGNAL\n",
+		"    if set, start_server executes its binary again when it receives the signal (e.g. USR2),\n",
+		"    and hands over the listening sockets and the --pid-file to the new start_server.\n",
+		"    The new start_server starts a new generation, and then the old start_server stops its workers and exits.\n",
+		"    If the new start_server fails to start, the old start_server keeps running.\n",
+		"    The signal cannot be used for --forward-signal.\n",
+		"\n",
+		"  --handover-socket=path\n",
+		"    if set, start_server listens on the unix socket at the path, and hands over the listening sockets\n",
+		"    to another start_server started with --takeover. After the other start_server starts its first generation,\n",
+		"    start_server stops its workers and exits.\n",
+		"\n",
+		"  --takeover=path\n",
+		"    if set, start_server takes over the listening sockets from the start_server of --handover-socket=path.\n",
+		"    The sockets are matched by their --port and --path options. Unmatched options are bound as usual.\n",
+		"    If no start_server listens on the path, start_server binds all the sockets by itself.\n",
+		"    If start_server doesn't start its first generation in a minute, the other start_server gives up the handover.\n",
+		"    --pid-file must differ from the one of the other start_server, or start_server exits before taking the sockets.\n",
+		"\n",
+		"  --forward-signal-to=newest|all\n",
+		"    if set to all, the signals of --forward-signal are relayed to the server processes of all generations (default: newest).\n",
+		"\n",
 		"  --pid-file=filename\n",
 		"    if set, writes the process id of the start_server process to the file.\n",
 		"\n",
@@ -48,11 +95,100 @@ func showHelp() {
 		"\n",
 		"  --envdir=ENVDIR:\n",
 		"    directory that contains environment variables to the server processes.\n",
+		"    It is compatible with envdir of daemontools: the value is the first line of the file without trailing spaces,\n",
+		"    NUL bytes are changed to newlines, and an empty file removes the variable.\n",
 		"    This can be overwritten by environment variable ENVDIR.\n",
 		"\n",
+		"  --env=KEY=VALUE:\n",
+		"    sets the environment variable to the server processes.\n",
+		"    This option can be specified multiple times.\n",
+		"\n",
+		"  --env-file=file:\n",
+		"    file in dotenv format that contains environment variables to the server processes.\n",
+		"    This option can be specified multiple times.\n",
+		"    start_server doesn't start the server processes while the file is broken.\n",
+		"\n",
+		"  --clear-env:\n",
+		"    if set, the server processes don't inherit the environment variables of start_server except --pass-env.\n",
+		"\n",
+		"  --pass-env=NAME1,NAME2,...:\n",
+		"    names of the environment variables to be passed to the server processes when --clear-env is set.\n",
+		"\n",
+		"    The environment variables are applied in the following order, later ones take precedence:\n",
+		"    the environment of start_server (or --pass-env with --clear-env), --env-file, --envdir, --env.\n",
+		"\n",
+		"  --watch-envdir:\n",
+		"    if set, spawns a new worker when the files in --envdir are added, changed or removed.\n",
+		"\n",
 		"  --log-file=file:\n",
 		"  --log-file=\"| cmd args...\":\n",
 		"    if set, redirects STDOUT and STDERR to given file or command\n",
+		"    If it is a file, start_server reopens it when it receives SIGUSR1 (see also --reopen-logs).\n",
+		"    If it is a command, start_server restarts it when it exits, buffering up to 1MiB of the logs meanwhile.\n",
+		"\n",
+		"  --log-file=syslog:///path/to/socket?facility=daemon&tag=name:\n",
+		"    sends the logs to the local syslog daemon. The path defaults to /dev/log,\n",
+		"    the facility defaults to user and the tag defaults to the name of the command.\n",
+		"    STDOUT is logged with severity info, STDERR with err.\n",
+		"\n",
+		"  --log-file=journald:///path/to/socket?facility=daemon&tag=name:\n",
+		"    sends the logs to systemd-journald in its native protocol.\n",
+		"    The path defaults to /run/systemd/journal/socket. The messages have\n",
+		"    SERVER_STARTER_GENERATION, SERVER_STARTER_PID and SERVER_STARTER_STREAM fields.\n",
+		"\n",
+		"    --stdout-log, --stderr-log and --starter-log accept these forms too.\n",
+		"\n",
+		"  --stdout-log=file:\n",
+		"  --stdout-log=\"| cmd args...\":\n",
+		"    if set, redirects STDOUT of the server processes to given file or command instead of --log-file.\n",
+		"\n",
+		"  --stderr-log=file:\n",
+		"  --stderr-log=\"| cmd args...\":\n",
+		"    if set, redirects STDERR of the server processes to given file or command instead of --log-file.\n",
+		"\n",
+		"  --starter-log=file:\n",
+		"  --starter-log=\"| cmd args...\":\n",
+		"    if set, redirects the messages of start_server itself to given file or command instead of --log-file.\n",
+		"\n",
+		"  --log-prefix:\n",
+		"    if set, prefixes each line of the output of the server processes with\n",
+		"    the timestamp, the generation, the process id and the stream name (stdout or stderr).\n",
+		"\n",
+		"  --log-format=(text|json):\n",
+		"    the format of the prefixed output and the messages of start_server (default: text).\n",
+		"\n",
+		"  --log-max-size=SIZE:\n",
+		"    if set, rotates the log file when its size exceeds SIZE (e.g. --log-max-size=100M).\n",
+		"\n",
+		"  --log-max-age=(seconds|Go's duration format):\n",
+		"    if set, rotates the log file when it has been written for the duration (e.g. --log-max-age=24h).\n",
+		"\n",
+		"  --log-max-backups=NUM:\n",
+		"    the number of the rotated log files to keep (default: 0, keeps all files).\n",
+		"\n",
+		"  --rlimit-nofile=(limit|soft:hard):\n",
+		"  --rlimit-core=(limit|soft:hard):\n",
+		"  --rlimit-nproc=(limit|soft:hard):\n",
+		"  --rlimit-as=(limit|soft:hard):\n",
+		"    resource limits for the server processes (optional, Linux only).\n",
+		"    The limits of start_server itself are not changed.\n",
+		"    Sizes accept K, M, G and T suffixes (e.g. --rlimit-as=4G), and \"unlimited\" means no limit.\n",
+		"\n",
+		"  --nice=NICE:\n",
+		"    the nice value of the server processes (optional).\n",
+		"\n",
+		"  --oom-score-adj=ADJ:\n",
+		"    the oom_score_adj of the server processes (optional, Linux only).\n",
+		"\n",
+		"  --starter-oom-score-adj=ADJ:\n",
+		"    the oom_score_adj of start_server itself (optional, Linux only).\n",
+		"    The server processes inherit it unless --oom-score-adj is set.\n",
+		"\n",
+		"  --cpu-affinity=CPUS:\n",
+		"    the list of CPUs on which the server processes run, such as \"0-3,8\" (optional, Linux only).\n",
+		"\n",
+		"  --umask=UMASK:\n",
+		"    the umask of the server processes in octal, such as \"022\" (optional).\n",
 		"\n",
 		"  --daemonize: (UNIMPLEMENTED)\n",
 		"    daemonizes the server.\n",
@@ -70,6 +206,43 @@ func showHelp() {
 		"    The default value is 5 when --enable-auto-restart is set, 0 otherwise.\n",
 		"    This can be overwritten by environment variable KILL_OLD_DELAY.\n",
 		"\n",
+		"  --max-rss=SIZE:\n",
+		"    if set, spawns a new worker when the resident set size of the newest generation\n",
+		"    exceeds SIZE for --max-rss-period (optional, Linux only).\n",
+		"    Sizes accept K, M, G and T suffixes (e.g. --max-rss=512M).\n",
+		"\n",
+		"  --max-rss-period=(seconds|Go's duration format):\n",
+		"    the period for which the resident set size must exceed --max-rss (default: 30).\n",
+		"\n",
+		"  --max-rss-include-children:\n",
+		"    if set, the resident set size includes the descendants of the server process.\n",
+		"\n",
+		"  --heartbeat-interval=(seconds|Go's duration format):\n",
+		"    if set, the server process must touch the file specified by the environment variable\n",
+		"    SERVER_STARTER_HEARTBEAT_FILE at the interval.\n",
+		"    start_server spawns a new worker if the newest worker misses --heartbeat-misses heartbeats.\n",
+		"\n",
+		"  --heartbeat-misses=NUM:\n",
+		"    the number of missed heartbeats to consider the server process hung (default: 3).\n",
+		"\n",
+		"  --watch=path:\n",
+		"    if set, spawns a new worker when the server program or the file is changed (optional).\n",
+		"    If the path is a directory, the files in the directory are watched.\n",
+		"    This option can be specified multiple times.\n",
+		"\n",
+		"  --watch-delay=(seconds|Go's duration format):\n",
+		"    the time to wait for the watched files to stop changing before spawning a new worker (default: 1).\n",
+		"\n",
+		"  --dev-watch=path:\n",
+		"    development mode: if the files are changed, runs the --build command\n",
+		"    and spawns a new worker if and only if the build succeeds (optional).\n",
+		"    If the path ends with \"/...\", the files in the directory are watched recursively (e.g. --dev-watch=./...).\n",
+		"    This option can be specified multiple times.\n",
+		"\n",
+		"  --build=\"cmd args...\":\n",
+		"    the command to build the server program in development mode.\n",
+		"    e.g. start_server --dev-watch=./... --build=\"go build -o bin/app ./cmd/app\" -- bin/app\n",
+		"\n",
 		"  --backlog=size: (UNIMPLEMENTED)\n",
 		"    specifies a listen backlog parameter, whose default is SOMAXCONN (usually 128 on Linux).\n",
 		"\n",
@@ -80,6 +253,13 @@ func showHelp() {
 		"  --stop\n",
 		"    this is a wrapper command that reads the pid of the start_server process from --pid-file, sends SIGTERM to the process.\n",
 		"\n",
+		"  --reopen-logs\n",
+		"    this is a wrapper command that reads the pid of the start_server process from --pid-file, sends SIGUSR1 to the process.\n",
+		"\n",
+		"  --upgrade\n",
+		"    this is a wrapper command that reads the pid of the start_server process from --pid-file,\n",
+		"    sends the signal of --upgrade-signal to the process and waits until the new start_server takes over the --pid-file.\n",
+		"\n",
 		"  --help\n",
 		"    prints this help.\n",
 		"\n",
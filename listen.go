@@ -0,0 +1,311 @@
+package starter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenOption is a --port or a --path option.
+type listenOption struct {
+	// "port" or "path"
+	kind string
+
+	// the name of the socket, e.g. "admin" of "--port=admin@127.0.0.1:9000".
+	name string
+
+	value string
+}
+
+func newListenOption(kind, value string) listenOption {
+	name, value := splitListenName(value)
+	return listenOption{kind: kind, name: name, value: value}
+}
+
+func (opt listenOption) String() string {
+	if opt.name != "" {
+		return "--" + opt.kind + "=" + opt.name + "@" + opt.value
+	}
+	return opt.key()
+}
+
+// key identifies the socket of the option. The name is not a part of the key,
+// so renaming the socket doesn't bind it again.
+func (opt listenOption) key() string {
+	return "--" + opt.kind + "=" + opt.value
+}
+
+// splitListenName splits the value of --port and --path options into the name and the address,
+// e.g. "admin@127.0.0.1:9000" into "admin" and "127.0.0.1:9000".
+// The name consists of letters, digits, '_' and '-'. If the value has no valid name, the name is empty.
+func splitListenName(value string) (string, string) {
+	idx := strings.IndexByte(value, '@')
+	if idx <= 0 {
+		// no name, or an abstract unix socket, e.g. "@app.sock".
+		return "", value
+	}
+	for _, r := range value[:idx] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return "", value
+		}
+	}
+	return value[:idx], value[idx+1:]
+}
+
+// listenSocket is a socket that start_server listens on.
+type listenSocket struct {
+	opt  listenOption
+	sock socket
+
+	// the parsed --path option, and the socket file just after it is bound.
+	unix *unixPath
+	stat os.FileInfo
+
+	// inherited is true while the old start_server may still use the socket file,
+	// until this start_server gets ready. see ownInheritedFiles.
+	inherited bool
+
+	// the number of the server processes that inherit the socket.
+	refs int
+
+	// retired is true if the socket is removed from the configuration.
+	// It is closed when no server process inherits it.
+	retired bool
+}
+
+// listenOptions returns the --port and --path options,
+// from the command line and ListenFile.
+func (s *Starter) listenOptions() ([]listenOption, error) {
+	opts := make([]listenOption, 0, len(s.Ports)+len(s.Paths))
+	for _, port := range s.Ports {
+		opts = append(opts, newListenOption("port", port))
+	}
+	for _, path := range s.Paths {
+		opts = append(opts, newListenOption("path", path))
+	}
+	if s.ListenFile != "" {
+		fileOpts, err := readListenFile(s.ListenFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, fileOpts...)
+	}
+
+	// the options are identified by their keys.
+	seen := make(map[string]struct{}, len(opts))
+	for _, opt := range opts {
+		key := opt.key()
+		if _, ok := seen[key]; ok {
+			return nil, fmt.Errorf("duplicated option: %s", key)
+		}
+		seen[key] = struct{}{}
+	}
+	return opts, nil
+}
+
+// expandListenOptions expands the port ranges and the host names of --port options,
+// so that every address is bound by its own socket.
+func expandListenOptions(ctx context.Context, opts []listenOption) ([]listenOption, error) {
+	expanded := make([]listenOption, 0, len(opts))
+	seen := make(map[string]struct{}, len(opts))
+	for _, opt := range opts {
+		values := []string{opt.value}
+		if opt.kind == "port" {
+			var err error
+			values, err = expandPort(ctx, opt.value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", opt, err)
+			}
+		}
+		for _, value := range values {
+			o := listenOption{kind: opt.kind, name: opt.name, value: value}
+			key := o.key()
+			if _, ok := seen[key]; ok {
+				return nil, fmt.Errorf("duplicated option: %s", key)
+			}
+			seen[key] = struct{}{}
+			expanded = append(expanded, o)
+		}
+	}
+	return expanded, nil
+}
+
+// expandPort expands a --port option, e.g. "localhost:8000-8001?reuseport" into
+// "127.0.0.1:8000?reuseport", "127.0.0.1:8001?reuseport", "[::1]:8000?reuseport" and "[::1]:8001?reuseport".
+// The option without ranges nor host names is returned as is.
+func expandPort(ctx context.Context, value string) ([]string, error) {
+	hostport, query := value, ""
+	if idx := strings.IndexByte(value, '?'); idx >= 0 {
+		hostport, query = value[:idx], value[idx:]
+	}
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// the port number only
+		ports, err := parsePortRange(hostport)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, 0, len(ports))
+		for _, port := range ports {
+			values = append(values, port+query)
+		}
+		return values, nil
+	}
+
+	ports, err := parsePortRange(port)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{host}
+	if host != "" && !isIPLiteral(host) {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		hosts = make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			hosts = append(hosts, addr.String())
+		}
+	}
+	if len(hosts) == 1 && len(ports) == 1 && hosts[0] == host {
+		return []string{value}, nil
+	}
+
+	values := make([]string, 0, len(hosts)*len(ports))
+	for _, host := range hosts {
+		for _, port := range ports {
+			values = append(values, net.JoinHostPort(host, port)+query)
+		}
+	}
+	return values, nil
+}
+
+// parsePortRange parses the port or the range of the ports, e.g. "8000", "8000-8015" or "u5000-5003".
+func parsePortRange(port string) ([]string, error) {
+	prefix := ""
+	if strings.HasPrefix(port, "u") {
+		prefix = "u"
+	}
+	idx := strings.IndexByte(port, '-')
+	if idx < 0 {
+		return []string{port}, nil
+	}
+	first, err1 := strconv.Atoi(port[len(prefix):idx])
+	last, err2 := strconv.Atoi(port[idx+1:])
+	if err1 != nil || err2 != nil || first <= 0 || last > 65535 || first > last {
+		return nil, errors.New("invalid port range: " + port)
+	}
+	ports := make([]string, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		ports = append(ports, prefix+strconv.Itoa(i))
+	}
+	return ports, nil
+}
+
+// isIPLiteral returns whether the host is an IP address, including a zone, e.g. "fe80::1%eth0".
+func isIPLiteral(host string) bool {
+	if idx := strings.LastIndexByte(host, '%'); idx >= 0 {
+		host = host[:idx]
+	}
+	return net.ParseIP(host) != nil
+}
+
+// readListenFile reads the file that contains --port and --path options, one option per line.
+// Empty lines and lines starting with '#' are ignored.
+func readListenFile(path string) ([]listenOption, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var opts []listenOption
+	scanner := bufio.NewScanner(f)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		idx := strings.IndexByte(line, '=')
+		if idx < 0 {
+			return nil, fmt.Errorf("%s:%d: --port=VALUE or --path=VALUE is expected: %s", path, lineno, line)
+		}
+		name, value := line[:idx], line[idx+1:]
+		switch name {
+		case "--port", "--path":
+			opts = append(opts, newListenOption(name[2:], value))
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown option: %s", path, lineno, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// acquireSockets returns the current sockets, and marks them as used by a server process.
+func (s *Starter) acquireSockets() []*listenSocket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sockets := make([]*listenSocket, len(s.listenSockets))
+	copy(sockets, s.listenSockets)
+	for _, ls := range sockets {
+		ls.refs++
+	}
+	return sockets
+}
+
+// releaseSockets marks the sockets as no longer used by the server process,
+// and closes the retired sockets that no server process uses.
+func (s *Starter) releaseSockets(sockets []*listenSocket) {
+	s.mu.Lock()
+	var closing []*listenSocket
+	for _, ls := range sockets {
+		ls.refs--
+		if ls.retired && ls.refs == 0 {
+			closing = append(closing, ls)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, ls := range closing {
+		s.logf("closing %s, no worker uses it", ls.opt)
+		s.closeSocket(ls)
+	}
+}
+
+// addr returns the address of the socket passed to the server processes.
+func (ls *listenSocket) addr() string {
+	if ls.unix != nil {
+		// the socket is bound under a temporary name, use the name in the option.
+		return ls.unix.path
+	}
+	if addr, ok := ls.sock.(interface{ Addr() net.Addr }); ok {
+		return addr.Addr().String()
+	}
+	if addr, ok := ls.sock.(interface{ LocalAddr() net.Addr }); ok {
+		return addr.LocalAddr().String()
+	}
+	panic("fail to get addr")
+}
+
+// closeSocket closes the socket, and removes its socket file.
+func (s *Starter) closeSocket(ls *listenSocket) {
+	ls.sock.Close()
+	if ls.unix == nil || ls.stat == nil || ls.inherited || s.handedOver.IsSet() {
+		// the new start_server still listens on the socket file.
+		return
+	}
+	if stat, err := os.Lstat(ls.unix.path); err == nil && os.SameFile(stat, ls.stat) {
+		os.Remove(ls.unix.path)
+	}
+}
@@ -0,0 +1,142 @@
+package starter
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListenOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	listenFile := filepath.Join(dir, "listen")
+	content := "# comment\n\n--port=8080\n  --path=/tmp/app.sock  \n"
+	if err := ioutil.WriteFile(listenFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Starter{
+		Ports:      []string{"80"},
+		ListenFile: listenFile,
+	}
+	opts, err := s.listenOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []listenOption{
+		{kind: "port", value: "80"},
+		{kind: "port", value: "8080"},
+		{kind: "path", value: "/tmp/app.sock"},
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("want %v, got %v", want, opts)
+	}
+
+	invalid := []string{
+		"8080\n",
+		"--dir=/tmp\n",
+		"--port=80\n", // duplicated
+	}
+	for _, content := range invalid {
+		if err := ioutil.WriteFile(listenFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.listenOptions(); err == nil {
+			t.Errorf("%q: want error, got nil", content)
+		}
+	}
+}
+
+func TestExpandListenOptions(t *testing.T) {
+	opts := []listenOption{
+		{kind: "port", value: "8000-8002"},
+		{kind: "port", value: "u5000-5001?rcvbuf=4M"},
+		{kind: "port", value: "127.0.0.1:9000-9001"},
+		{kind: "port", value: "[::1]:9000"},
+		{kind: "port", value: "http"},
+		{kind: "path", value: "/tmp/app.sock"},
+	}
+	got, err := expandListenOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []listenOption{
+		{kind: "port", value: "8000"},
+		{kind: "port", value: "8001"},
+		{kind: "port", value: "8002"},
+		{kind: "port", value: "u5000?rcvbuf=4M"},
+		{kind: "port", value: "u5001?rcvbuf=4M"},
+		{kind: "port", value: "127.0.0.1:9000"},
+		{kind: "port", value: "127.0.0.1:9001"},
+		{kind: "port", value: "[::1]:9000"},
+		{kind: "port", value: "http"},
+		{kind: "path", value: "/tmp/app.sock"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	invalid := [][]listenOption{
+		{{kind: "port", value: "8000-"}},
+		{{kind: "port", value: "8001-8000"}},
+		{{kind: "port", value: "8000-65536"}},
+		{{kind: "port", value: "8000-8001"}, {kind: "port", value: "8001"}}, // duplicated
+	}
+	for _, opts := range invalid {
+		if _, err := expandListenOptions(context.Background(), opts); err == nil {
+			t.Errorf("%v: want error, got nil", opts)
+		}
+	}
+}
+
+func TestExpandPort_HostName(t *testing.T) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(context.Background(), "localhost")
+	if err != nil {
+		t.Skipf("fail to resolve localhost: %s", err)
+	}
+	got, err := expandPort(context.Background(), "localhost:8000-8001?reuseport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, addr := range addrs {
+		want = append(want,
+			net.JoinHostPort(addr.String(), "8000")+"?reuseport",
+			net.JoinHostPort(addr.String(), "8001")+"?reuseport",
+		)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestSplitListenName(t *testing.T) {
+	tests := []struct {
+		in    string
+		name  string
+		value string
+	}{
+		{in: "admin@127.0.0.1:9000", name: "admin", value: "127.0.0.1:9000"},
+		{in: "web-1@8000-8003", name: "web-1", value: "8000-8003"},
+		{in: "logs@unixgram:/tmp/log.sock", name: "logs", value: "unixgram:/tmp/log.sock"},
+		{in: "app@@app.sock", name: "app", value: "@app.sock"},
+		{in: "@app.sock", name: "", value: "@app.sock"},
+		{in: "/tmp/a@b.sock", name: "", value: "/tmp/a@b.sock"},
+		{in: "app@1.sock", name: "app", value: "1.sock"},
+		{in: "./app@1.sock", name: "", value: "./app@1.sock"},
+		{in: "127.0.0.1:9000", name: "", value: "127.0.0.1:9000"},
+	}
+	for _, tt := range tests {
+		name, value := splitListenName(tt.in)
+		if name != tt.name || value != tt.value {
+			t.Errorf("%s: want %q and %q, got %q and %q", tt.in, tt.name, tt.value, name, value)
+		}
+	}
+}
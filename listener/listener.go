@@ -20,6 +20,10 @@ type ListenConfig interface {
 // copied from the starter package.
 const PortEnvName = "SERVER_STARTER_PORT"
 
+// PortNamesEnvName is the environment name for the names of the sockets.
+// copied from the starter package.
+const PortNamesEnvName = "SERVER_STARTER_PORT_NAMES"
+
 // ErrNoListeningTarget is returned by ListenAll calls
 // when the process is not started using server_starter.
 var ErrNoListeningTarget = errors.New("listener: no listening target")
@@ -39,6 +43,14 @@ type ListenSpec interface {
 	// Addr returns the address.
 	Addr() string
 
+	// Network returns the network of the socket: "tcp4", "tcp6", "udp4", "udp6", "unix", "unixgram" or "unixpacket".
+	// It returns an empty string if the network is unknown.
+	Network() string
+
+	// Name returns the name of the socket, e.g. "admin" of --port=admin@127.0.0.1:9000.
+	// It returns an empty string if the socket is not named.
+	Name() string
+
 	// return a string compatible with SERVER_STARTER_PORT
 	String() string
 }
@@ -64,7 +76,8 @@ func (ll ListenSpecs) String() string {
 }
 
 // Listen announces on the local network address.
-// The network must be "tcp", "tcp4", "tcp6", "unix".
+// The network must be "tcp", "tcp4", "tcp6", "unix", "unixpacket".
+// The address of "unix" that starts with '@' is an abstract unix socket on Linux.
 func (ll ListenSpecs) Listen(ctx context.Context, network, address string) (net.Listener, error) {
 	var addrlist []string
 	switch network {
@@ -112,56 +125,30 @@ func (ll ListenSpecs) Listen(ctx context.Context, network, address string) (net.
 				addrlist = append(addrlist, "127.0.0.1:"+port)
 			}
 		}
-	case "unix":
-		stat1, err := os.Stat(address)
+	case "unix", "unixpacket":
+		specs, err := ll.lookupUnix(address)
 		if err != nil {
 			return nil, err
 		}
-		for _, l := range ll {
-			stat2, err := os.Stat(l.Addr())
-			if err != nil {
-				continue
-			}
-			if os.SameFile(stat1, stat2) {
-				ln, err := l.Listen()
-				if err != nil {
-					continue
-				}
-				if _, ok := ln.(*net.UnixListener); !ok {
-					ln.Close()
-					continue
-				}
-				return ln, nil
-			}
+		l, err := selectSpec(network, address, specs)
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("listener: address %s is not being bound to the server", address)
+		return l.Listen()
 	default:
 		return nil, net.UnknownNetworkError(network)
 	}
 
-	for _, l := range ll {
-		a := l.Addr()
-		for _, addr := range addrlist {
-			if addr != a {
-				continue
-			}
-			ln, err := l.Listen()
-			if err != nil {
-				continue
-			}
-			if _, ok := ln.(*net.TCPListener); !ok {
-				ln.Close()
-				continue
-			}
-			return ln, nil
-		}
+	l, err := selectSpec(network, address, ll.lookupAddrs(addrlist))
+	if err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("listener: address %s is not being bound to the server", address)
+	return l.Listen()
 }
 
 // ListenPacket announces on the local network address.
-// The network must be "udp", "udp4", "udp6".
+// The network must be "udp", "udp4", "udp6", "unixgram".
+// The address of "unixgram" that starts with '@' is an abstract unix socket on Linux.
 func (ll ListenSpecs) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
 	var addrlist []string
 	switch network {
@@ -209,29 +196,37 @@ func (ll ListenSpecs) ListenPacket(ctx context.Context, network, address string)
 				addrlist = append(addrlist, "127.0.0.1:"+port)
 			}
 		}
+	case "unixgram":
+		specs, err := ll.lookupUnix(address)
+		if err != nil {
+			return nil, err
+		}
+		l, err := selectSpec(network, address, specs)
+		if err != nil {
+			return nil, err
+		}
+		return l.ListenPacket()
 	default:
 		return nil, net.UnknownNetworkError(network)
 	}
 
+	l, err := selectSpec(network, address, ll.lookupAddrs(addrlist))
+	if err != nil {
+		return nil, err
+	}
+	return l.ListenPacket()
+}
+
+// ByName returns the specs of the sockets that have the name.
+// A name may have multiple sockets, e.g. --port=web@8000-8003.
+func (ll ListenSpecs) ByName(name string) ListenSpecs {
+	var ret ListenSpecs
 	for _, l := range ll {
-		a := l.Addr()
-		for _, addr := range addrlist {
-			if addr != a {
-				continue
-			}
-			conn, err := l.ListenPacket()
-			if err != nil {
-				continue
-			}
-			if _, ok := conn.(*net.UDPConn); !ok {
-				conn.Close()
-				continue
-			}
-			return conn, nil
+		if l.Name() == name {
+			ret = append(ret, l)
 		}
 	}
-
-	return nil, fmt.Errorf("listener: address %s is not being bound to the server", address)
+	return ret
 }
 
 // ListenAll announces on the local network address.
@@ -260,8 +255,80 @@ func (ll ListenSpecs) ListenPacketAll(ctx context.Context) ([]net.PacketConn, er
 	return ret, nil
 }
 
+// lookupAddrs returns the specs that are bound to one of the addresses.
+func (ll ListenSpecs) lookupAddrs(addrlist []string) []ListenSpec {
+	var specs []ListenSpec
+	for _, l := range ll {
+		a := l.Addr()
+		for _, addr := range addrlist {
+			if addr == a {
+				specs = append(specs, l)
+				break
+			}
+		}
+	}
+	return specs
+}
+
+// selectSpec returns the first spec of the network in the specs bound to the address.
+// The spec of the unknown network is also returned, and the caller tries it as before.
+func selectSpec(network, address string, specs []ListenSpec) (ListenSpec, error) {
+	for _, l := range specs {
+		if n := l.Network(); n == "" || matchNetwork(n, network) {
+			return l, nil
+		}
+	}
+	if len(specs) > 0 {
+		got := specs[0].Network()
+		if got == "" {
+			got = "an unknown socket"
+		}
+		return nil, fmt.Errorf("listener: address %s is bound as %s, not %s", address, got, network)
+	}
+	return nil, fmt.Errorf("listener: address %s is not being bound to the server", address)
+}
+
+// lookupUnix returns the specs that are bound to the unix socket address.
+func (ll ListenSpecs) lookupUnix(address string) ([]ListenSpec, error) {
+	var specs []ListenSpec
+	if isAbstractUnix(address) {
+		// the abstract sockets have no file, compare their names.
+		for _, l := range ll {
+			if l.Addr() == address {
+				specs = append(specs, l)
+			}
+		}
+		return specs, nil
+	}
+
+	stat1, err := os.Stat(address)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range ll {
+		if isAbstractUnix(l.Addr()) {
+			// don't confuse it with the file of the same name.
+			continue
+		}
+		stat2, err := os.Stat(l.Addr())
+		if err != nil {
+			continue
+		}
+		if os.SameFile(stat1, stat2) {
+			specs = append(specs, l)
+		}
+	}
+	return specs, nil
+}
+
+// isAbstractUnix returns whether the address is an abstract unix socket, e.g. "@myapp.sock".
+func isAbstractUnix(address string) bool {
+	return strings.HasPrefix(address, "@")
+}
+
 type listenSpec struct {
 	addr string
+	name string
 	fd   uintptr
 }
 
@@ -269,6 +336,10 @@ func (l listenSpec) Addr() string {
 	return l.addr
 }
 
+func (l listenSpec) Name() string {
+	return l.name
+}
+
 func (l listenSpec) String() string {
 	return fmt.Sprintf("%s=%d", l.addr, l.fd)
 }
@@ -277,12 +348,56 @@ func (l listenSpec) Fd() uintptr {
 	return l.fd
 }
 
+func (l listenSpec) Network() string {
+	network, err := socketNetwork(l.fd)
+	if err != nil {
+		return ""
+	}
+	return network
+}
+
 func (l listenSpec) Listen() (net.Listener, error) {
-	return net.FileListener(os.NewFile(l.fd, l.addr))
+	// if the network is unknown, try it as before.
+	if network, err := socketNetwork(l.fd); err == nil && !isStreamNetwork(network) {
+		return nil, fmt.Errorf("listener: %s is a %s socket, use ListenPacket instead", l.addr, network)
+	}
+	f, dup, err := l.file()
+	if err != nil {
+		return nil, err
+	}
+	if dup {
+		defer f.Close()
+	}
+	return net.FileListener(f)
 }
 
 func (l listenSpec) ListenPacket() (net.PacketConn, error) {
-	return net.FilePacketConn(os.NewFile(l.fd, l.addr))
+	// if the network is unknown, try it as before.
+	if network, err := socketNetwork(l.fd); err == nil && !isPacketNetwork(network) {
+		return nil, fmt.Errorf("listener: %s is a %s socket, use Listen instead", l.addr, network)
+	}
+	f, dup, err := l.file()
+	if err != nil {
+		return nil, err
+	}
+	if dup {
+		defer f.Close()
+	}
+	return net.FilePacketConn(f)
+}
+
+// file returns a file of the socket.
+// If dup is true, the file descriptor is duplicated and the caller should close the file.
+func (l listenSpec) file() (f *os.File, dup bool, err error) {
+	f, err = dupFile(l.fd, l.addr)
+	if err == errNotSupported {
+		// the file descriptor can't be duplicated on this platform, use it as is.
+		return os.NewFile(l.fd, l.addr), false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("listener: %s: %v", l.addr, err)
+	}
+	return f, true, nil
 }
 
 func parseListenTargets(str string, ok bool) (ListenSpecs, error) {
@@ -316,6 +431,32 @@ func parseListenTargets(str string, ok bool) (ListenSpecs, error) {
 	return ret, nil
 }
 
+// parseListenNames sets the names in SERVER_STARTER_PORT_NAMES to the specs.
+// The format is the same as SERVER_STARTER_PORT, e.g. "admin=3;web=4".
+func parseListenNames(ll ListenSpecs, str string) error {
+	if str == "" {
+		return nil
+	}
+	for _, pairString := range strings.Split(str, ";") {
+		pair := strings.SplitN(pairString, "=", 2)
+		if len(pair) != 2 {
+			return fmt.Errorf("failed to parse '%s' as listen name", pairString)
+		}
+		name := strings.TrimSpace(pair[0])
+		fd, err := strconv.ParseUint(strings.TrimSpace(pair[1]), 10, 0)
+		if err != nil {
+			return fmt.Errorf("failed to parse '%s' as listen name: %s", pairString, err)
+		}
+		for i, l := range ll {
+			if spec, ok := l.(listenSpec); ok && spec.fd == uintptr(fd) {
+				spec.name = name
+				ll[i] = spec
+			}
+		}
+	}
+	return nil
+}
+
 // PortsSpecification returns the value of SERVER_STARTER_PORT
 // environment variable.
 // If the process starts from the start_server command,
@@ -333,6 +474,9 @@ func Ports() (ListenSpecs, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := parseListenNames(ll, os.Getenv(PortNamesEnvName)); err != nil {
+		return nil, err
+	}
 	return ll, nil
 }
 
@@ -346,6 +490,9 @@ func Ports() (ListenSpecs, error) {
 func PortsFallback() (ListenConfig, error) {
 	ll, err := parseListenTargets(PortsSpecification())
 	if err == nil {
+		if err := parseListenNames(ll, os.Getenv(PortNamesEnvName)); err != nil {
+			return nil, err
+		}
 		return ll, nil
 	}
 	if err != ErrNoListeningTarget {
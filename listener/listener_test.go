@@ -2,11 +2,13 @@ package listener
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -225,6 +227,95 @@ func TestListenConfigs(t *testing.T) {
 		wantNG(ctx, t, ll, "tcp", "127.0.0.1:8000")
 		wantNG(ctx, t, ll, "tcp4", "127.0.0.1:8000")
 	})
+
+	t.Run("unixpacket", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "server-starter-test")
+		if err != nil {
+			t.Fatalf("Failed to create temp directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		sock := filepath.Join(dir, "sock")
+		l, err := net.Listen("unixpacket", sock)
+		if err != nil {
+			t.Skip("unixpacket is not supported?")
+			return
+		}
+		defer l.Close()
+
+		f, err := l.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		ll := ListenSpecs{
+			listenSpec{
+				addr: sock,
+				fd:   f.Fd(),
+			},
+		}
+		wantOK(ctx, t, ll, "unixpacket", sock)
+		wantNG(ctx, t, ll, "unix", sock)
+		wantNG(ctx, t, ll, "tcp", sock)
+	})
+
+	t.Run("unix-abstract", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("abstract unix sockets are supported only on Linux")
+		}
+
+		dir, err := ioutil.TempDir("", "server-starter-test")
+		if err != nil {
+			t.Fatalf("Failed to create temp directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		pwd, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("fail to getwd:%s", err)
+		}
+		os.Chdir(dir)
+		defer os.Chdir(pwd)
+
+		name := fmt.Sprintf("@server-starter-test-%d.sock", os.Getpid())
+		l, err := net.Listen("unix", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		f, err := l.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a file that has the same name as the abstract socket.
+		file, err := net.Listen("unix", name[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if err := os.Rename(name[1:], name); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		ll := ListenSpecs{
+			listenSpec{
+				addr: name,
+				fd:   f.Fd(),
+			},
+		}
+		wantOK(ctx, t, ll, "unix", name)
+		wantNG(ctx, t, ll, "unix", filepath.Join(dir, name))
+		wantNG(ctx, t, ll, "unix", "@no-such-socket")
+		wantNG(ctx, t, ll, "tcp", name)
+	})
 }
 
 func TestListenConfigs_ListenPacket(t *testing.T) {
@@ -395,6 +486,44 @@ func TestListenConfigs_ListenPacket(t *testing.T) {
 		wantOK(ctx, t, ll, "udp6", "[::1]:"+port)
 		wantNG(ctx, t, ll, "udp", "127.0.0.1:"+port)
 	})
+
+	t.Run("unixgram", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "server-starter-test")
+		if err != nil {
+			t.Fatalf("Failed to create temp directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		sock := filepath.Join(dir, "sock")
+		conn, err := net.ListenPacket("unixgram", sock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		f, err := conn.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		ll := ListenSpecs{
+			listenSpec{
+				addr: sock,
+				fd:   f.Fd(),
+			},
+		}
+		wantOK(ctx, t, ll, "unixgram", sock)
+		wantNG(ctx, t, ll, "unixgram", filepath.Join(dir, "no-such-socket"))
+		wantNG(ctx, t, ll, "udp", sock)
+
+		if l, err := ll.Listen(ctx, "unix", sock); err == nil {
+			l.Close()
+			t.Errorf("unix, %s: error expected, got nil", sock)
+		}
+	})
 }
 
 func TestPort(t *testing.T) {
@@ -484,3 +613,155 @@ func TestPortNoEnv(t *testing.T) {
 		t.Errorf("Ports must return nil if no env")
 	}
 }
+
+func TestPortNames(t *testing.T) {
+	ll, err := parseListenTargets("127.0.0.1:9000=3;0.0.0.0:8000=4;0.0.0.0:8001=5;/tmp/foo.sock=6", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseListenNames(ll, "admin=3;web=4;web=5"); err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(ll))
+	for i, l := range ll {
+		names[i] = l.Name()
+	}
+	if want := []string{"admin", "web", "web", ""}; !reflect.DeepEqual(names, want) {
+		t.Errorf("want %v, got %v", want, names)
+	}
+
+	if admin := ll.ByName("admin"); admin.String() != "127.0.0.1:9000=3" {
+		t.Errorf("want 127.0.0.1:9000=3, got %s", admin.String())
+	}
+	if web := ll.ByName("web"); web.String() != "0.0.0.0:8000=4;0.0.0.0:8001=5" {
+		t.Errorf("want 0.0.0.0:8000=4;0.0.0.0:8001=5, got %s", web.String())
+	}
+	if unknown := ll.ByName("unknown"); len(unknown) != 0 {
+		t.Errorf("want empty, got %s", unknown.String())
+	}
+
+	errs := []string{
+		"admin=foo", // invalid fd
+		"admin",     // missing fd
+	}
+	for i, tc := range errs {
+		if err := parseListenNames(ll, tc); err == nil {
+			t.Errorf("#%d: want error, got nil", i)
+		}
+	}
+}
+
+func TestListenSpec_Network(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	type fileSocket interface {
+		File() (*os.File, error)
+		Close() error
+	}
+	tests := []struct {
+		network string
+		address string
+		want    string
+	}{
+		{network: "tcp4", address: "127.0.0.1:0", want: "tcp4"},
+		{network: "udp4", address: "127.0.0.1:0", want: "udp4"},
+		{network: "unix", address: filepath.Join(dir, "unix.sock"), want: "unix"},
+		{network: "unixgram", address: filepath.Join(dir, "unixgram.sock"), want: "unixgram"},
+		{network: "unixpacket", address: filepath.Join(dir, "unixpacket.sock"), want: "unixpacket"},
+	}
+	var ll ListenSpecs
+	for _, tt := range tests {
+		var sock fileSocket
+		var addr string
+		switch tt.network {
+		case "udp4", "unixgram":
+			conn, err := net.ListenPacket(tt.network, tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sock, addr = conn.(fileSocket), conn.LocalAddr().String()
+		default:
+			l, err := net.Listen(tt.network, tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sock, addr = l.(fileSocket), l.Addr().String()
+		}
+		defer sock.Close()
+		f, err := sock.File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		spec := listenSpec{addr: addr, fd: f.Fd()}
+		if got := spec.Network(); got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.network, tt.want, got)
+		}
+		ll = append(ll, spec)
+	}
+
+	// the stream sockets
+	for _, spec := range []ListenSpec{ll[0], ll[2], ll[4]} {
+		if _, err := spec.ListenPacket(); err == nil {
+			t.Errorf("%s: want error, got nil", spec.Addr())
+		}
+		// the inherited file descriptor is kept open, so it can be used again.
+		for i := 0; i < 2; i++ {
+			l, err := spec.Listen()
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", spec.Addr(), err)
+				continue
+			}
+			l.Close()
+		}
+	}
+
+	// the datagram sockets
+	for _, spec := range []ListenSpec{ll[1], ll[3]} {
+		if _, err := spec.Listen(); err == nil {
+			t.Errorf("%s: want error, got nil", spec.Addr())
+		}
+		for i := 0; i < 2; i++ {
+			conn, err := spec.ListenPacket()
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", spec.Addr(), err)
+				continue
+			}
+			conn.Close()
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := ll.Listen(ctx, "tcp", ll[1].Addr()); err == nil {
+		t.Errorf("want error, got nil")
+	}
+	if _, err := ll.ListenPacket(ctx, "unixgram", ll[2].Addr()); err == nil {
+		t.Errorf("want error, got nil")
+	}
+	listeners, err := ll.ListenAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 3 {
+		t.Errorf("want 3 listeners, got %d", len(listeners))
+	}
+	for _, l := range listeners {
+		l.Close()
+	}
+	conns, err := ll.ListenPacketAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 2 {
+		t.Errorf("want 2 conns, got %d", len(conns))
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,35 @@
+package listener
+
+import "errors"
+
+var errNotSupported = errors.New("not supported on this platform")
+
+// isStreamNetwork returns whether the socket of the network is used by Listen.
+func isStreamNetwork(network string) bool {
+	switch network {
+	case "tcp4", "tcp6", "unix", "unixpacket":
+		return true
+	}
+	return false
+}
+
+// isPacketNetwork returns whether the socket of the network is used by ListenPacket.
+func isPacketNetwork(network string) bool {
+	switch network {
+	case "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+// matchNetwork returns whether the socket of the network can be used for the requested network,
+// e.g. both "tcp4" and "tcp6" sockets can be used for "tcp".
+func matchNetwork(network, requested string) bool {
+	switch requested {
+	case "tcp", "tcp4", "tcp6":
+		return network == "tcp4" || network == "tcp6"
+	case "udp", "udp4", "udp6":
+		return network == "udp4" || network == "udp6"
+	}
+	return network == requested
+}
@@ -0,0 +1,34 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd netbsd openbsd solaris
+
+package listener
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// socketNetwork returns the network name of the socket.
+// SO_DOMAIN is not available on this platform, so the domain is determined by the address of the socket.
+func socketNetwork(fd uintptr) (string, error) {
+	sa, err := syscall.Getsockname(int(fd))
+	if err != nil {
+		return "", err
+	}
+	var domain int
+	switch sa.(type) {
+	case *syscall.SockaddrInet4:
+		domain = syscall.AF_INET
+	case *syscall.SockaddrInet6:
+		domain = syscall.AF_INET6
+	case *syscall.SockaddrUnix:
+		domain = syscall.AF_UNIX
+	default:
+		return "", fmt.Errorf("unknown socket address: %T", sa)
+	}
+	typ, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return "", err
+	}
+	return networkName(domain, typ)
+}
@@ -0,0 +1,16 @@
+package listener
+
+import "syscall"
+
+// socketNetwork returns the network name of the socket.
+func socketNetwork(fd uintptr) (string, error) {
+	domain, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_DOMAIN)
+	if err != nil {
+		return "", err
+	}
+	typ, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return "", err
+	}
+	return networkName(domain, typ)
+}
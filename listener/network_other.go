@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !solaris && !windows
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!solaris,!windows
+
+package listener
+
+import "os"
+
+// socketNetwork returns the network name of the socket.
+func socketNetwork(fd uintptr) (string, error) {
+	return "", errNotSupported
+}
+
+// dupFile returns a new file of the duplicated file descriptor.
+func dupFile(fd uintptr, name string) (*os.File, error) {
+	return nil, errNotSupported
+}
@@ -0,0 +1,52 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd || solaris
+// +build linux darwin dragonfly freebsd netbsd openbsd solaris
+
+package listener
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// networkName returns the network name of the socket domain and the socket type.
+func networkName(domain, typ int) (string, error) {
+	switch domain {
+	case syscall.AF_INET, syscall.AF_INET6:
+		suffix := "4"
+		if domain == syscall.AF_INET6 {
+			suffix = "6"
+		}
+		switch typ {
+		case syscall.SOCK_STREAM:
+			return "tcp" + suffix, nil
+		case syscall.SOCK_DGRAM:
+			return "udp" + suffix, nil
+		}
+	case syscall.AF_UNIX:
+		switch typ {
+		case syscall.SOCK_STREAM:
+			return "unix", nil
+		case syscall.SOCK_DGRAM:
+			return "unixgram", nil
+		case syscall.SOCK_SEQPACKET:
+			return "unixpacket", nil
+		}
+	}
+	return "", fmt.Errorf("unknown socket: domain %d, type %d", domain, typ)
+}
+
+// dupFile returns a new file of the duplicated file descriptor,
+// so that closing the file doesn't close the inherited one.
+func dupFile(fd uintptr, name string) (*os.File, error) {
+	syscall.ForkLock.RLock()
+	newfd, err := syscall.Dup(int(fd))
+	if err == nil {
+		syscall.CloseOnExec(newfd)
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(newfd), name), nil
+}
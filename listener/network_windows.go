@@ -0,0 +1,13 @@
+package listener
+
+import "os"
+
+// socketNetwork returns the network name of the socket.
+func socketNetwork(fd uintptr) (string, error) {
+	return "", errNotSupported
+}
+
+// dupFile returns a new file of the duplicated file descriptor.
+func dupFile(fd uintptr, name string) (*os.File, error) {
+	return nil, errNotSupported
+}
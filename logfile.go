@@ -0,0 +1,216 @@
+package starter
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFile is a log file that supports reopening and rotation.
+type logFile struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	// rotation settings, zero means disabled.
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+}
+
+func newLogFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*logFile, error) {
+	l := &logFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := l.openLocked(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) openLocked() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.size = stat.Size()
+	l.openedAt = time.Now()
+	return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, os.ErrClosed
+	}
+	if l.file == nil {
+		// the last reopen failed, try again.
+		if err := l.openLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if l.needsRotationLocked(len(p)) {
+		// if the rotation fails, keep writing into the current file rather than dropping the logs.
+		// the rotation is tried again by the next write.
+		l.rotateLocked()
+	}
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+func (l *logFile) needsRotationLocked(n int) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.maxSize > 0 && l.size+int64(n) > l.maxSize {
+		return true
+	}
+	if l.maxAge > 0 && time.Since(l.openedAt) >= l.maxAge {
+		return true
+	}
+	return false
+}
+
+// Reopen closes the log file, and opens it again.
+// It is used with external log rotation tools, such as logrotate.
+func (l *logFile) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return os.ErrClosed
+	}
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	return l.openLocked()
+}
+
+// the layout of the timestamp in the names of rotated log files.
+const logFileTimeLayout = "20060102-150405"
+
+// rotateLocked renames the log file to the name with timestamp, and opens new one.
+// the current file is kept open if it fails.
+func (l *logFile) rotateLocked() error {
+	base := l.path + "." + time.Now().Format(logFileTimeLayout)
+	backup := base
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = base + "." + strconv.Itoa(i)
+	}
+	// the log file may be removed by someone, then there is nothing to rename.
+	if err := os.Rename(l.path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	old := l.file
+	if err := l.openLocked(); err != nil {
+		return err
+	}
+	old.Close()
+	l.removeOldBackupsLocked()
+	return nil
+}
+
+// removeOldBackupsLocked removes the rotated log files except the newest maxBackups files.
+func (l *logFile) removeOldBackupsLocked() {
+	if l.maxBackups <= 0 {
+		return
+	}
+	backups := l.backupsLocked()
+	if len(backups) <= l.maxBackups {
+		return
+	}
+	for _, backup := range backups[:len(backups)-l.maxBackups] {
+		os.Remove(backup)
+	}
+}
+
+// backupsLocked returns the rotated log files, from oldest to newest.
+func (l *logFile) backupsLocked() []string {
+	matches, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return nil
+	}
+	backups := matches[:0]
+	for _, match := range matches {
+		suffix := match[len(l.path)+1:]
+		if len(suffix) < len(logFileTimeLayout) {
+			continue
+		}
+		if _, err := time.Parse(logFileTimeLayout, suffix[:len(logFileTimeLayout)]); err != nil {
+			continue
+		}
+		backups = append(backups, match)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backupLess(backups[i], backups[j])
+	})
+	return backups
+}
+
+// backupLess compares the names of rotated log files, e.g. "app.log.20060102-150405.2".
+func backupLess(a, b string) bool {
+	timeA, seqA := splitBackupName(a)
+	timeB, seqB := splitBackupName(b)
+	if timeA != timeB {
+		return timeA < timeB
+	}
+	return seqA < seqB
+}
+
+func splitBackupName(name string) (string, int) {
+	idx := strings.LastIndexByte(name, '.')
+	seq, err := strconv.Atoi(name[idx+1:])
+	if err != nil || len(name)-idx-1 == len(logFileTimeLayout) {
+		return name, 0
+	}
+	return name[:idx], seq
+}
+
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// reopenLogFile reopens the log files, if they are plain files.
+func (s *Starter) reopenLogFile() error {
+	var errs errorList
+	for _, sink := range s.logSinks {
+		if l, ok := sink.(*logFile); ok {
+			if err := l.Reopen(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogFile_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	l, err := newLogFile(path, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Write([]byte("line1\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// emulate logrotate
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Write([]byte("line2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Write([]byte("line3\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := ioutil.ReadFile(path + ".1"); string(data) != "line1\nline2\n" {
+		t.Errorf("want line1 and line2, got %q", data)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "line3\n" {
+		t.Errorf("want line3, got %q", data)
+	}
+}
+
+func TestLogFile_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	l, err := newLogFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// each write rotates the log file.
+	lines := []string{"line1\n", "line2\n", "line3\n", "line4\n"}
+	for _, line := range lines {
+		if _, err := l.Write([]byte(line + line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if data, _ := ioutil.ReadFile(path); string(data) != "line4\nline4\n" {
+		t.Errorf("want line4, got %q", data)
+	}
+	backups := l.backupsLocked()
+	if len(backups) != 2 {
+		t.Fatalf("want 2 backups, got %v", backups)
+	}
+	if data, _ := ioutil.ReadFile(backups[0]); string(data) != "line2\nline2\n" {
+		t.Errorf("want line2, got %q", data)
+	}
+	if data, _ := ioutil.ReadFile(backups[1]); string(data) != "line3\nline3\n" {
+		t.Errorf("want line3, got %q", data)
+	}
+}
+
+func TestLogFile_RotateRemoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	l, err := newLogFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Write([]byte("line1\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the log file is removed, and the rotation has nothing to rename.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Write([]byte("line2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "line2\n" {
+		t.Errorf("want line2, got %q", data)
+	}
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Write([]byte("line3\n")); err != nil {
+		t.Fatal(err)
+	}
+	// line2 is rotated again by line3.
+	if data, _ := ioutil.ReadFile(path); string(data) != "line3\n" {
+		t.Errorf("want line3, got %q", data)
+	}
+
+	// the log file is not writable after close.
+	l.Close()
+	if _, err := l.Write([]byte("line4\n")); err != os.ErrClosed {
+		t.Errorf("want os.ErrClosed, got %v", err)
+	}
+	if err := l.Reopen(); err != os.ErrClosed {
+		t.Errorf("want os.ErrClosed, got %v", err)
+	}
+}
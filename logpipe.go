@@ -0,0 +1,275 @@
+package starter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// the maximum size of the output buffered while the log command is down.
+	logPipeBufferSize = 1024 * 1024
+
+	// the interval of restarting the log command.
+	// it doubles every failure, and is reset if the command runs longer than logPipeStableTime.
+	logPipeMinBackoff = 100 * time.Millisecond
+	logPipeMaxBackoff = 30 * time.Second
+	logPipeStableTime = 10 * time.Second
+
+	// the maximum time to wait for the log command to read the rest of the logs on close.
+	logPipeCloseTimeout = 10 * time.Second
+)
+
+// logPipe is the log command that start_server writes the logs into its STDIN.
+// It restarts the command if the command exits.
+type logPipe struct {
+	command string
+
+	// failures of the command are reported into errlog.
+	errlog io.Writer
+
+	// the size of buf.
+	size int
+
+	// the log command is killed if it doesn't exit in closeTimeout after close.
+	closeTimeout time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	running bool
+	closed  bool
+	dropped int
+	proc    *logProcess
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// logProcess is a running log command.
+type logProcess struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	started time.Time
+	exited  chan struct{}
+	err     error
+}
+
+// newLogPipe starts the log command.
+func newLogPipe(command string, errlog io.Writer, size int) (*logPipe, error) {
+	p := &logPipe{
+		command: command,
+		errlog:  errlog,
+		size:    size,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+
+		closeTimeout: logPipeCloseTimeout,
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	// the first failure is reported to the caller.
+	proc, err := p.start()
+	if err != nil {
+		return nil, err
+	}
+	go p.run(proc)
+	return p, nil
+}
+
+func (p *logPipe) start() (*logProcess, error) {
+	cmd := exec.Command("sh", "-c", p.command)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	proc := &logProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		started: time.Now(),
+		exited:  make(chan struct{}),
+	}
+	go func() {
+		err := cmd.Wait()
+		p.mu.Lock()
+		proc.err = err
+		close(proc.exited)
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}()
+
+	p.mu.Lock()
+	p.running = true
+	p.proc = proc
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	return proc, nil
+}
+
+// Write writes the logs into the buffer.
+// It blocks while the buffer is full and the log command is running,
+// and drops the logs while the log command is down.
+func (p *logPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.running && !p.closed && len(p.buf) > 0 && len(p.buf)+len(b) > p.size {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return 0, os.ErrClosed
+	}
+	if !p.running && len(p.buf)+len(b) > p.size {
+		p.dropped += len(b)
+		return len(b), nil
+	}
+	p.buf = append(p.buf, b...)
+	p.cond.Broadcast()
+	return len(b), nil
+}
+
+func (p *logPipe) run(proc *logProcess) {
+	defer close(p.done)
+	backoff := logPipeMinBackoff
+	for {
+		if p.pump(proc) {
+			return
+		}
+
+		// the log command exited unexpectedly. restart it.
+		if time.Since(proc.started) > logPipeStableTime {
+			backoff = logPipeMinBackoff
+		}
+		fmt.Fprintf(p.errlog, "start_server: log command %q exited (%v), restarting in %v\n", p.command, proc.err, backoff)
+		for {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-p.closing:
+				timer.Stop()
+				p.discard()
+				return
+			}
+			if backoff *= 2; backoff > logPipeMaxBackoff {
+				backoff = logPipeMaxBackoff
+			}
+
+			var err error
+			proc, err = p.start()
+			if err == nil {
+				break
+			}
+			fmt.Fprintf(p.errlog, "start_server: failed to restart log command %q (%v), retrying in %v\n", p.command, err, backoff)
+		}
+
+		p.mu.Lock()
+		dropped := p.dropped
+		p.dropped = 0
+		p.mu.Unlock()
+		if dropped > 0 {
+			fmt.Fprintf(p.errlog, "start_server: dropped %d bytes of the logs while log command %q was down\n", dropped, p.command)
+		}
+	}
+}
+
+// pump copies the buffer into the log command until the command exits.
+// It returns true if the log pipe is closed and all the logs are written.
+func (p *logPipe) pump(proc *logProcess) bool {
+	for {
+		p.mu.Lock()
+		for len(p.buf) == 0 && !p.closed && !isClosedChan(proc.exited) {
+			p.cond.Wait()
+		}
+		if isClosedChan(proc.exited) {
+			p.running = false
+			p.cond.Broadcast()
+			p.mu.Unlock()
+			return false
+		}
+		if len(p.buf) == 0 && p.closed {
+			p.mu.Unlock()
+			proc.stdin.Close()
+			<-proc.exited
+			return true
+		}
+		data := p.buf
+		p.buf = nil
+		p.cond.Broadcast()
+		p.mu.Unlock()
+
+		n, err := proc.stdin.Write(data)
+		if err != nil {
+			// the log command is down. keep the rest of the logs until it restarts.
+			p.mu.Lock()
+			p.buf = append(data[n:], p.buf...)
+			if len(p.buf) > p.size {
+				p.dropped += len(p.buf) - p.size
+				p.buf = p.buf[:p.size]
+			}
+			p.running = false
+			p.cond.Broadcast()
+			p.mu.Unlock()
+			proc.stdin.Close()
+			<-proc.exited
+			return false
+		}
+	}
+}
+
+// discard drops the buffered logs, because the log pipe is closed while the log command is down.
+func (p *logPipe) discard() {
+	p.mu.Lock()
+	dropped := p.dropped + len(p.buf)
+	p.buf = nil
+	p.dropped = 0
+	p.mu.Unlock()
+	if dropped > 0 {
+		fmt.Fprintf(p.errlog, "start_server: dropped %d bytes of the logs because log command %q is down\n", dropped, p.command)
+	}
+}
+
+// Close flushes the buffer and waits for the log command to exit.
+// If the log command doesn't exit in closeTimeout, Close kills it.
+func (p *logPipe) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	close(p.closing)
+
+	timer := time.NewTimer(p.closeTimeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return nil
+	case <-timer.C:
+	}
+
+	// the log command doesn't read the logs any more. give up flushing.
+	fmt.Fprintf(p.errlog, "start_server: log command %q doesn't exit in %v after close, killing\n", p.command, p.closeTimeout)
+	p.mu.Lock()
+	proc := p.proc
+	p.mu.Unlock()
+	proc.cmd.Process.Kill()
+	proc.stdin.Close() // unblock the pending write
+	<-p.done
+	return nil
+}
+
+func isClosedChan(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
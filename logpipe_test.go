@@ -0,0 +1,138 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogPipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logfile := filepath.Join(dir, "log")
+
+	var errlog lockedBuffer
+	p, err := newLogPipe("cat >> "+logfile, &errlog, logPipeBufferSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		p.Write([]byte("hello\n"))
+	}
+	p.Close()
+
+	got, err := ioutil.ReadFile(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("hello\n", 100); string(got) != want {
+		t.Errorf("want %d bytes, got %d bytes", len(want), len(got))
+	}
+	if errlog.String() != "" {
+		t.Errorf("unexpected error log: %q", errlog.String())
+	}
+}
+
+func TestLogPipe_Restart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logfile := filepath.Join(dir, "log")
+
+	// the log command exits after each line.
+	var errlog lockedBuffer
+	p, err := newLogPipe("head -n 1 >> "+logfile, &errlog, logPipeBufferSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Write([]byte("foo\n"))
+	time.Sleep(time.Second)
+	p.Write([]byte("bar\n"))
+	time.Sleep(time.Second)
+	p.Close()
+
+	got, err := ioutil.ReadFile(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "foo\nbar\n" {
+		t.Errorf("want %q, got %q", "foo\nbar\n", string(got))
+	}
+	if !strings.Contains(errlog.String(), "restarting") {
+		t.Errorf("want the report of restarting, got %q", errlog.String())
+	}
+}
+
+func TestLogPipe_Drop(t *testing.T) {
+	var errlog lockedBuffer
+	p, err := newLogPipe("exit 1", &errlog, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the log command to exit.
+	for {
+		p.mu.Lock()
+		running := p.running
+		p.mu.Unlock()
+		if !running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the logs are buffered up to the size, and the rest are dropped.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Write([]byte("0123456789"))
+		p.Write([]byte("0123456789"))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write is blocked while the log command is down")
+	}
+	p.Close()
+
+	if !strings.Contains(errlog.String(), "dropped") {
+		t.Errorf("want the report of dropped logs, got %q", errlog.String())
+	}
+	if _, err := p.Write([]byte("foo")); err == nil {
+		t.Error("want error after close, got nil")
+	}
+}
+
+func TestLogPipe_CloseTimeout(t *testing.T) {
+	var errlog lockedBuffer
+	p, err := newLogPipe("sleep 60", &errlog, logPipeBufferSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.closeTimeout = 100 * time.Millisecond
+
+	// fill the pipe, the log command never reads it.
+	p.Write(make([]byte, logPipeBufferSize))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close is blocked while the log command doesn't read the logs")
+	}
+	if !strings.Contains(errlog.String(), "killing") {
+		t.Errorf("want the report of killing, got %q", errlog.String())
+	}
+}
@@ -0,0 +1,271 @@
+package starter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyslogPath   = "/dev/log"
+	defaultJournaldPath = "/run/systemd/journal/socket"
+)
+
+// the severities of syslog.
+const (
+	severityErr    = 3
+	severityNotice = 5
+	severityInfo   = 6
+)
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// logRecord is a line of the output of the server process.
+type logRecord struct {
+	time       time.Time
+	generation int
+	pid        int
+	stream     string
+	message    string
+}
+
+// recordWriter is a log destination that keeps the metadata of the lines,
+// instead of formatting them into text.
+type recordWriter interface {
+	WriteRecord(r *logRecord) error
+}
+
+func isRecordWriter(w interface{}) bool {
+	_, ok := w.(recordWriter)
+	return ok
+}
+
+// severity returns the severity of the record in syslog.
+func (r *logRecord) severity() int {
+	switch r.stream {
+	case "stderr":
+		return severityErr
+	case "stdout":
+		return severityInfo
+	}
+	return severityNotice
+}
+
+// datagramSink sends the log records to a local daemon over the unix datagram socket.
+type datagramSink struct {
+	mu       sync.Mutex
+	path     string
+	conn     net.Conn
+	closed   bool
+	facility int
+	tag      string
+	format   func(r *logRecord, facility int, tag string) []byte
+}
+
+// newDatagramSink parses the spec of a syslog:// or journald:// destination.
+// The spec is in the form of "scheme:///path/to/socket?facility=daemon&tag=myapp".
+func newDatagramSink(spec, defaultPath, defaultTag string) (*datagramSink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "" {
+		return nil, fmt.Errorf("%s: only local sockets are supported", spec)
+	}
+	sink := &datagramSink{
+		path:     u.Path,
+		facility: syslogFacilities["user"],
+		tag:      defaultTag,
+	}
+	if sink.path == "" {
+		sink.path = defaultPath
+	}
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		switch key {
+		case "facility":
+			f, ok := syslogFacilities[value]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown facility: %s", spec, value)
+			}
+			sink.facility = f
+		case "tag":
+			if value == "" {
+				return nil, fmt.Errorf("%s: empty tag", spec)
+			}
+			sink.tag = value
+		default:
+			return nil, fmt.Errorf("%s: unknown option: %s", spec, key)
+		}
+	}
+	return sink, nil
+}
+
+func (s *Starter) openSyslogSink(spec string) (*datagramSink, error) {
+	sink, err := newDatagramSink(spec, defaultSyslogPath, s.logTag())
+	if err != nil {
+		return nil, err
+	}
+	sink.format = formatSyslog
+	if err := sink.dial(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *Starter) openJournaldSink(spec string) (*datagramSink, error) {
+	sink, err := newDatagramSink(spec, defaultJournaldPath, s.logTag())
+	if err != nil {
+		return nil, err
+	}
+	sink.format = formatJournald
+	if err := sink.dial(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// logTag returns the default identifier of the log messages.
+func (s *Starter) logTag() string {
+	if s.Command != "" {
+		return filepath.Base(s.Command)
+	}
+	return "start_server"
+}
+
+func (sink *datagramSink) dial() error {
+	conn, err := net.Dial("unixgram", sink.path)
+	if err != nil {
+		return err
+	}
+	sink.conn = conn
+	return nil
+}
+
+// WriteRecord sends the record.
+func (sink *datagramSink) WriteRecord(r *logRecord) error {
+	data := sink.format(r, sink.facility, sink.tag)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.closed {
+		return os.ErrClosed
+	}
+	if sink.conn != nil {
+		if _, err := sink.conn.Write(data); err == nil {
+			return nil
+		}
+		sink.conn.Close()
+		sink.conn = nil
+	}
+
+	// the daemon may be restarted. try to reconnect.
+	if err := sink.dial(); err != nil {
+		return err
+	}
+	_, err := sink.conn.Write(data)
+	return err
+}
+
+// Write sends each line of p as the messages of start_server.
+func (sink *datagramSink) Write(p []byte) (int, error) {
+	now := time.Now()
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		err := sink.WriteRecord(&logRecord{
+			time:    now,
+			pid:     os.Getpid(),
+			stream:  "start_server",
+			message: line,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (sink *datagramSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.closed = true
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+// formatSyslog formats the record in the format of the local syslog daemon.
+func formatSyslog(r *logRecord, facility int, tag string) []byte {
+	return []byte(fmt.Sprintf(
+		"<%d>%s %s[%d]: %s",
+		facility<<3|r.severity(), r.time.Format(time.Stamp), tag, r.pid, r.message,
+	))
+}
+
+// formatJournald formats the record in the native protocol of systemd-journald.
+// See https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+func formatJournald(r *logRecord, facility int, tag string) []byte {
+	var buf bytes.Buffer
+	writeJournaldField(&buf, "MESSAGE", r.message)
+	writeJournaldField(&buf, "PRIORITY", strconv.Itoa(r.severity()))
+	writeJournaldField(&buf, "SYSLOG_FACILITY", strconv.Itoa(facility))
+	writeJournaldField(&buf, "SYSLOG_IDENTIFIER", tag)
+	writeJournaldField(&buf, "SYSLOG_PID", strconv.Itoa(r.pid))
+	writeJournaldField(&buf, "SERVER_STARTER_STREAM", r.stream)
+	if r.generation > 0 {
+		writeJournaldField(&buf, "SERVER_STARTER_GENERATION", strconv.Itoa(r.generation))
+		writeJournaldField(&buf, "SERVER_STARTER_PID", strconv.Itoa(r.pid))
+	}
+	return buf.Bytes()
+}
+
+func writeJournaldField(buf *bytes.Buffer, name, value string) {
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	// the values that contain newlines are serialized in binary.
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,175 @@
+package starter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenDaemon binds the unix datagram socket as the stand-in of the log daemon.
+func listenDaemon(t *testing.T) (string, net.PacketConn, func()) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return path, conn, func() {
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func readDatagram(t *testing.T, conn net.PacketConn) []byte {
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestSyslogSink(t *testing.T) {
+	path, conn, cleanup := listenDaemon(t)
+	defer cleanup()
+
+	s := &Starter{Command: "/usr/local/bin/app"}
+	sink, err := s.openLogSink("syslog://" + path + "?facility=local0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	err = sink.(recordWriter).WriteRecord(&logRecord{
+		time:       time.Now(),
+		generation: 1,
+		pid:        1234,
+		stream:     "stderr",
+		message:    "something wrong",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(readDatagram(t, conn))
+	if !strings.HasPrefix(got, "<131>") { // local0.err
+		t.Errorf("unexpected priority: %q", got)
+	}
+	if !strings.HasSuffix(got, " app[1234]: something wrong") {
+		t.Errorf("unexpected message: %q", got)
+	}
+
+	// the messages of start_server.
+	if _, err := sink.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	got = string(readDatagram(t, conn))
+	if !strings.HasPrefix(got, "<133>") { // local0.notice
+		t.Errorf("unexpected priority: %q", got)
+	}
+	if !strings.HasSuffix(got, ": hello") {
+		t.Errorf("unexpected message: %q", got)
+	}
+}
+
+func TestJournaldSink(t *testing.T) {
+	path, conn, cleanup := listenDaemon(t)
+	defer cleanup()
+
+	s := &Starter{}
+	sink, err := s.openLogSink("journald://" + path + "?tag=myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	err = sink.(recordWriter).WriteRecord(&logRecord{
+		time:       time.Now(),
+		generation: 2,
+		pid:        1234,
+		stream:     "stdout",
+		message:    "multi\nline",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readDatagram(t, conn)
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len("multi\nline")))
+	fields := [][]byte{
+		append(append([]byte("MESSAGE\n"), size[:]...), "multi\nline\n"...),
+		[]byte("PRIORITY=6\n"),
+		[]byte("SYSLOG_IDENTIFIER=myapp\n"),
+		[]byte("SYSLOG_PID=1234\n"),
+		[]byte("SERVER_STARTER_STREAM=stdout\n"),
+		[]byte("SERVER_STARTER_GENERATION=2\n"),
+		[]byte("SERVER_STARTER_PID=1234\n"),
+	}
+	for _, field := range fields {
+		if !bytes.Contains(got, field) {
+			t.Errorf("want field %q in %q", field, got)
+		}
+	}
+}
+
+func TestDatagramSink_Records(t *testing.T) {
+	path, conn, cleanup := listenDaemon(t)
+	defer cleanup()
+
+	s := &Starter{LogFile: "journald://" + path}
+	if err := s.openLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.openWorkerOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.pipes) != 2 {
+		t.Fatalf("want 2 pipes, got %d", len(out.pipes))
+	}
+	go s.copyLines(out.pipes[1], 3, 1234)
+	out.stderr.Write([]byte("foo\nbar\n"))
+	out.closeWriters()
+
+	for _, want := range []string{"foo", "bar"} {
+		got := readDatagram(t, conn)
+		if !bytes.Contains(got, []byte("MESSAGE="+want+"\n")) {
+			t.Errorf("want message %q, got %q", want, got)
+		}
+		if !bytes.Contains(got, []byte("PRIORITY=3\n")) {
+			t.Errorf("want priority err, got %q", got)
+		}
+		if !bytes.Contains(got, []byte("SERVER_STARTER_GENERATION=3\n")) {
+			t.Errorf("want generation, got %q", got)
+		}
+	}
+	s.closeAsyncWriters()
+	for _, sink := range s.logSinks {
+		sink.Close()
+	}
+}
+
+func TestNewDatagramSink_Error(t *testing.T) {
+	specs := []string{
+		"syslog://example.com:514",
+		"syslog:///dev/log?facility=unknown",
+		"syslog:///dev/log?tag=",
+		"journald:///run/systemd/journal/socket?unknown=1",
+	}
+	for _, spec := range specs {
+		if _, err := newDatagramSink(spec, defaultSyslogPath, "test"); err == nil {
+			t.Errorf("%s: want error, got nil", spec)
+		}
+	}
+}
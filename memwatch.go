@@ -0,0 +1,76 @@
+package starter
+
+import (
+	"fmt"
+	"time"
+)
+
+// rssWatcher watches the resident set size of the newest generation,
+// and reloads the workers if it exceeds MaxRSS for MaxRSSPeriod.
+func (s *Starter) rssWatcher() {
+	period := s.maxRSSPeriod()
+	interval := time.Second
+	if period < interval {
+		interval = period
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var generation int
+	var since time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		w := s.newestWorker()
+		if w == nil {
+			continue
+		}
+		if w.generation != generation {
+			// new generation is started, reset the state.
+			generation = w.generation
+			since = time.Time{}
+		}
+		rss, err := readRSS(w.Pid(), s.MaxRSSIncludeChildren)
+		if err != nil {
+			continue // the worker may have exited
+		}
+		if rss <= s.MaxRSS {
+			since = time.Time{}
+			continue
+		}
+		now := time.Now()
+		if since.IsZero() {
+			since = now
+		}
+		if d := now.Sub(since); d >= period {
+			s.logf("worker %d exceeds max-rss for %s (rss=%s, max-rss=%s), spawning a new worker", w.Pid(), d, formatSize(rss), formatSize(s.MaxRSS))
+			since = time.Time{}
+			go s.Reload()
+		}
+	}
+}
+
+func (s *Starter) maxRSSPeriod() time.Duration {
+	if s.MaxRSSPeriod > 0 {
+		return s.MaxRSSPeriod
+	}
+	return 30 * time.Second
+}
+
+// formatSize formats the size in the same units as parseSize.
+func formatSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit && exp < 3; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGT"[exp])
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -51,12 +52,24 @@ func ParseArgs(args []string) (*Starter, error) {
 		switch args[i] {
 		case "--enable-auto-restart":
 			s.EnableAutoRestart = true
+		case "--watch-envdir":
+			s.WatchEnvDir = true
+		case "--clear-env":
+			s.ClearEnv = true
+		case "--max-rss-include-children":
+			s.MaxRSSIncludeChildren = true
 		case "--daemonize":
 			s.Daemonize = true
 		case "--restart":
 			s.Restart = true
 		case "--stop":
 			s.Stop = true
+		case "--reopen-logs":
+			s.ReopenLogs = true
+		case "--upgrade":
+			s.Upgrade = true
+		case "--log-prefix":
+			s.LogPrefix = true
 		case "--help":
 			s.Help = true
 		case "--version":
@@ -84,16 +97,51 @@ func ParseArgs(args []string) (*Starter, error) {
 		}
 		switch opt {
 		case "--port":
+			if _, err := parsePortOption(newListenOption("port", value).value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid --port value: %v", err))
+			}
 			s.Ports = append(s.Ports, value)
 		case "--path":
+			if _, err := parseUnixPath(newListenOption("path", value).value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid --path value: %v", err))
+			}
 			s.Paths = append(s.Paths, value)
 		case "--interval":
 			s.Interval, err = parseDuration(value)
 			if err != nil {
 				errs = append(errs, fmt.Errorf("invalid --interval format: %s", value))
 			}
+		case "--listen-file":
+			s.ListenFile = value
 		case "--log-file":
 			s.LogFile = value
+		case "--stdout-log":
+			s.StdoutLog = value
+		case "--stderr-log":
+			s.StderrLog = value
+		case "--starter-log":
+			s.StarterLog = value
+		case "--log-format":
+			if value != "text" && value != "json" {
+				errs = append(errs, fmt.Errorf("unknown log format for --log-format: %s", value))
+				break
+			}
+			s.LogFormat = value
+		case "--log-max-size":
+			s.LogMaxSize, err = parseSize(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid --log-max-size format: %s", value))
+			}
+		case "--log-max-age":
+			s.LogMaxAge, err = parseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid --log-max-age format: %s", value))
+			}
+		case "--log-max-backups":
+			s.LogMaxBackups, err = strconv.Atoi(value)
+			if err != nil || s.LogMaxBackups < 0 {
+				errs = append(errs, fmt.Errorf("invalid --log-max-backups value: %s", value))
+			}
 		case "--pid-file":
 			s.PidFile = value
 		case "--dir":
@@ -110,16 +158,131 @@ func ParseArgs(args []string) (*Starter, error) {
 			} else {
 				errs = append(errs, fmt.Errorf("unknown signal name for --signal-on-term: %s", value))
 			}
+		case "--forward-signal":
+			signals, err := parseForwardSignals(value)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			s.ForwardSignals = append(s.ForwardSignals, signals...)
+		case "--forward-signal-to":
+			switch value {
+			case "newest":
+				s.ForwardSignalToAll = false
+			case "all":
+				s.ForwardSignalToAll = true
+			default:
+				errs = append(errs, fmt.Errorf("invalid --forward-signal-to value, newest or all is expected: %s", value))
+			}
+		case "--upgrade-signal":
+			signal := nameToSignal(value)
+			if signal == nil {
+				errs = append(errs, fmt.Errorf("unknown signal name for --upgrade-signal: %s", value))
+				break
+			}
+			switch signal {
+			case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGKILL, syscall.SIGSTOP, syscall.SIGCHLD:
+				errs = append(errs, fmt.Errorf("%s cannot be used for --upgrade-signal", signalToName(signal)))
+			default:
+				s.UpgradeSignal = signal
+			}
+		case "--handover-socket":
+			s.HandoverSocket = value
+		case "--takeover":
+			s.Takeover = value
 		case "--backlog":
 			errs = append(errs, errors.New("--backlog is not supported"))
 		case "--envdir":
 			s.EnvDir = value
+		case "--env":
+			if idx := strings.IndexByte(value, '='); idx <= 0 {
+				errs = append(errs, fmt.Errorf("invalid --env format, KEY=VALUE is expected: %s", value))
+				break
+			}
+			s.Env = append(s.Env, value)
+		case "--env-file":
+			s.EnvFiles = append(s.EnvFiles, value)
+		case "--pass-env":
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					s.PassEnv = append(s.PassEnv, name)
+				}
+			}
 		case "--auto-restart-interval":
 			autoRestartInterval = value
 		case "--kill-old-delay":
 			killOldDelay = value
 		case "--status-file":
 			s.StatusFile = value
+		case "--rlimit-nofile", "--rlimit-core", "--rlimit-nproc", "--rlimit-as":
+			rlimit, err := parseRlimit(strings.TrimPrefix(opt, "--rlimit-"), value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s format: %s: %s", opt, value, err))
+				break
+			}
+			s.Rlimits = append(s.Rlimits, rlimit)
+		case "--max-rss":
+			s.MaxRSS, err = parseSize(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid --max-rss format: %s", value))
+			}
+		case "--max-rss-period":
+			s.MaxRSSPeriod, err = parseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid --max-rss-period format: %s", value))
+			}
+		case "--heartbeat-interval":
+			s.HeartbeatInterval, err = parseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid --heartbeat-interval format: %s", value))
+			}
+		case "--heartbeat-misses":
+			s.HeartbeatMisses, err = strconv.Atoi(value)
+			if err != nil || s.HeartbeatMisses <= 0 {
+				errs = append(errs, fmt.Errorf("invalid --heartbeat-misses value: %s", value))
+			}
+		case "--watch":
+			s.Watch = append(s.Watch, value)
+		case "--watch-delay":
+			s.WatchDelay, err = parseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid --watch-delay format: %s", value))
+			}
+		case "--dev-watch":
+			s.DevWatch = append(s.DevWatch, value)
+		case "--build":
+			s.Build = value
+		case "--nice":
+			nice, err := strconv.Atoi(value)
+			if err != nil || nice < -20 || nice > 19 {
+				errs = append(errs, fmt.Errorf("invalid --nice value: %s", value))
+				break
+			}
+			s.Nice = &nice
+		case "--oom-score-adj", "--starter-oom-score-adj":
+			adj, err := strconv.Atoi(value)
+			if err != nil || adj < -1000 || adj > 1000 {
+				errs = append(errs, fmt.Errorf("invalid %s value: %s", opt, value))
+				break
+			}
+			if opt == "--oom-score-adj" {
+				s.OOMScoreAdj = &adj
+			} else {
+				s.StarterOOMScoreAdj = &adj
+			}
+		case "--cpu-affinity":
+			s.CPUAffinity, err = parseCPUList(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid --cpu-affinity format: %s: %s", value, err))
+			}
+		case "--umask":
+			umask, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || umask > 0777 {
+				errs = append(errs, fmt.Errorf("invalid --umask format: %s", value))
+				break
+			}
+			mask := int(umask)
+			s.Umask = &mask
 		default:
 			errs = append(errs, fmt.Errorf("unknown option %s", opt))
 		}
@@ -129,6 +292,14 @@ func ParseArgs(args []string) (*Starter, error) {
 		s.Args = cmd[1:]
 	}
 
+	// waitSignal handles the upgrade signal first, so it would never be forwarded.
+	for _, sig := range s.ForwardSignals {
+		if s.UpgradeSignal != nil && sig == s.UpgradeSignal {
+			errs = append(errs, fmt.Errorf("%s cannot be used for both --upgrade-signal and --forward-signal", signalToName(sig)))
+			break
+		}
+	}
+
 	if killOldDelay != "" {
 		s.KillOldDelay, err = parseDuration(killOldDelay)
 		if err != nil {
@@ -156,3 +327,32 @@ func parseDuration(s string) (time.Duration, error) {
 	}
 	return 0, fmt.Errorf("invalid format: %s", s)
 }
+
+// parseSize parses a size, such as "1024", "64K", "512M" or "4G".
+func parseSize(s string) (uint64, error) {
+	var unit uint64 = 1
+	num := s
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			unit = 1 << 10
+		case 'm', 'M':
+			unit = 1 << 20
+		case 'g', 'G':
+			unit = 1 << 30
+		case 't', 'T':
+			unit = 1 << 40
+		}
+		if unit != 1 {
+			num = s[:len(s)-1]
+		}
+	}
+	v, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid format: %s", s)
+	}
+	if v > ^uint64(0)/unit {
+		return 0, fmt.Errorf("too large: %s", s)
+	}
+	return v * unit, nil
+}
@@ -1,7 +1,9 @@
 package starter
 
 import (
+	"os"
 	"reflect"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -115,4 +117,147 @@ func TestParseArgs(t *testing.T) {
 			t.Errorf("want 1234,2345, got %#v", s.Ports)
 		}
 	})
+
+	t.Run("rlimit", func(t *testing.T) {
+		s, err := ParseArgs([]string{"start_server", "--rlimit-nofile", "1024:4096", "--rlimit-core=unlimited", "--rlimit-as=4G"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Rlimit{
+			{Resource: "nofile", Cur: 1024, Max: 4096},
+			{Resource: "core", Cur: RlimInfinity, Max: RlimInfinity},
+			{Resource: "as", Cur: 4 << 30, Max: 4 << 30},
+		}
+		if !reflect.DeepEqual(s.Rlimits, want) {
+			t.Errorf("want %v, got %v", want, s.Rlimits)
+		}
+	})
+
+	t.Run("invalid rlimit", func(t *testing.T) {
+		_, err := ParseArgs([]string{"start_server", "--rlimit-nofile", "4096:1024"})
+		if err == nil {
+			t.Error("want error, got nil")
+		}
+	})
+
+	t.Run("scheduling attributes", func(t *testing.T) {
+		s, err := ParseArgs([]string{"start_server", "--nice=10", "--oom-score-adj=500", "--cpu-affinity=0-2,5", "--umask=027"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Nice == nil || *s.Nice != 10 {
+			t.Errorf("want nice 10, got %v", s.Nice)
+		}
+		if s.OOMScoreAdj == nil || *s.OOMScoreAdj != 500 {
+			t.Errorf("want oom_score_adj 500, got %v", s.OOMScoreAdj)
+		}
+		if !reflect.DeepEqual(s.CPUAffinity, []int{0, 1, 2, 5}) {
+			t.Errorf("want 0,1,2,5, got %v", s.CPUAffinity)
+		}
+		if s.Umask == nil || *s.Umask != 027 {
+			t.Errorf("want umask 027, got %v", s.Umask)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		s, err := ParseArgs([]string{"start_server", "--max-rss", "512M"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.MaxRSS != 512*1024*1024 {
+			t.Errorf("want 512M, got %d", s.MaxRSS)
+		}
+	})
+
+	t.Run("heartbeat", func(t *testing.T) {
+		s, err := ParseArgs([]string{"start_server", "--heartbeat-interval=5", "--heartbeat-misses=2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.HeartbeatInterval != 5*time.Second {
+			t.Errorf("want 5s, got %s", s.HeartbeatInterval)
+		}
+		if s.HeartbeatMisses != 2 {
+			t.Errorf("want 2, got %d", s.HeartbeatMisses)
+		}
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		s, err := ParseArgs([]string{"start_server", "--env", "FOO=foo=bar", "--clear-env", "--pass-env=PATH, HOME", "--env-file=.env"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s.Env, []string{"FOO=foo=bar"}) {
+			t.Errorf("want FOO=foo=bar, got %#v", s.Env)
+		}
+		if !s.ClearEnv {
+			t.Error("want true, got false")
+		}
+		if !reflect.DeepEqual(s.PassEnv, []string{"PATH", "HOME"}) {
+			t.Errorf("want PATH,HOME, got %#v", s.PassEnv)
+		}
+		if !reflect.DeepEqual(s.EnvFiles, []string{".env"}) {
+			t.Errorf("want .env, got %#v", s.EnvFiles)
+		}
+
+		if _, err := ParseArgs([]string{"start_server", "--env", "=foo"}); err == nil {
+			t.Error("want error, got nil")
+		}
+	})
+	t.Run("forward signal", func(t *testing.T) {
+		s, err := ParseArgs([]string{"start_server", "--forward-signal=USR1,SIGUSR2", "--forward-signal", "ttin", "--forward-signal-to=all"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGTTIN}
+		if !reflect.DeepEqual(s.ForwardSignals, want) {
+			t.Errorf("want %v, got %v", want, s.ForwardSignals)
+		}
+		if !s.ForwardSignalToAll {
+			t.Error("want true, got false")
+		}
+
+		if _, err := ParseArgs([]string{"start_server", "--forward-signal=TERM"}); err == nil {
+			t.Error("want error, got nil")
+		}
+		if _, err := ParseArgs([]string{"start_server", "--forward-signal=UNKNOWN"}); err == nil {
+			t.Error("want error, got nil")
+		}
+	})
+	t.Run("upgrade signal", func(t *testing.T) {
+		s, err := ParseArgs([]string{"start_server", "--upgrade-signal=USR2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.UpgradeSignal != syscall.SIGUSR2 {
+			t.Errorf("want USR2, got %v", s.UpgradeSignal)
+		}
+
+		if _, err := ParseArgs([]string{"start_server", "--upgrade-signal=HUP"}); err == nil {
+			t.Error("want error, got nil")
+		}
+		if _, err := ParseArgs([]string{"start_server", "--upgrade-signal=USR2", "--forward-signal=TTIN,USR2"}); err == nil {
+			t.Error("want error, got nil")
+		}
+	})
+
+	t.Run("port options", func(t *testing.T) {
+		s, err := ParseArgs([]string{"start_server", "--port=127.0.0.1:8080?reuseport&rcvbuf=4M", "--port=u8081?sndbuf=64K"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"127.0.0.1:8080?reuseport&rcvbuf=4M", "u8081?sndbuf=64K"}; !reflect.DeepEqual(s.Ports, want) {
+			t.Errorf("want %v, got %v", want, s.Ports)
+		}
+
+		if _, err := ParseArgs([]string{"start_server", "--port=8080?no-such-option"}); err == nil {
+			t.Error("want error, got nil")
+		}
+		if _, err := ParseArgs([]string{"start_server", "--port=u8080?nodelay"}); err == nil {
+			t.Error("want error, got nil")
+		}
+		if _, err := ParseArgs([]string{"start_server", "--port=admin@127.0.0.1:9000?reuseport", "--path=logs@unixgram:/tmp/log.sock"}); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
 }
@@ -0,0 +1,373 @@
+package starter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the size of the queue of asyncWriter, in lines.
+const outputQueueSize = 1024
+
+// the maximum time to wait for copying the rest of the output after the server processes exit.
+// the descendants of the server processes may keep the pipes open.
+const outputCloseTimeout = 5 * time.Second
+
+// the maximum length of a line of the output of the server process.
+// longer lines are split.
+const maxLineLength = 64 * 1024
+
+// workerOutput is the destination of the output of a server process.
+type workerOutput struct {
+	// the files that are passed to the server process.
+	stdout *os.File
+	stderr *os.File
+
+	pipes []*outputPipe
+}
+
+// outputPipe is a pipe that start_server copies the output of the server process through.
+type outputPipe struct {
+	r, w *os.File
+
+	// the name of the stream, "stdout" or "stderr".
+	// it is empty if the pipe is shared by stdout and stderr.
+	stream string
+
+	// if true, dest is a recordWriter and the lines are sent with their metadata.
+	records bool
+
+	dest io.Writer
+}
+
+// openWorkerOutput opens the destination of the output of the server process.
+func (s *Starter) openWorkerOutput() (*workerOutput, error) {
+	out := &workerOutput{}
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if s.stdoutLog != nil {
+		stdout = s.stdoutLog
+	}
+	if s.stderrLog != nil {
+		stderr = s.stderrLog
+	}
+
+	if s.LogPrefix || isRecordWriter(stdout) || isRecordWriter(stderr) {
+		var err error
+		if out.stdout, err = s.linePipe(out, "stdout", stdout); err != nil {
+			return nil, err
+		}
+		if out.stderr, err = s.linePipe(out, "stderr", stderr); err != nil {
+			out.closeReaders()
+			out.closeWriters()
+			return nil, err
+		}
+		return out, nil
+	}
+
+	if stdout == stderr {
+		// stdout and stderr share the pipe to keep the order of the output.
+		p, err := out.addPipe("", stdout)
+		if err != nil {
+			return nil, err
+		}
+		out.stdout = p.w
+		out.stderr = p.w
+		return out, nil
+	}
+
+	var err error
+	if out.stdout, err = out.rawFile(stdout); err != nil {
+		return nil, err
+	}
+	if out.stderr, err = out.rawFile(stderr); err != nil {
+		out.closeReaders()
+		out.closeWriters()
+		return nil, err
+	}
+	return out, nil
+}
+
+// linePipe returns the file that start_server reads the output line by line through.
+// The lines are sent to the destinations that keep the metadata as is,
+// and are prefixed for the others if LogPrefix is set.
+func (s *Starter) linePipe(out *workerOutput, stream string, w io.Writer) (*os.File, error) {
+	records := isRecordWriter(w)
+	if !records && !s.LogPrefix {
+		return out.rawFile(w)
+	}
+	p, err := out.addPipe(stream, s.asyncWriter(w))
+	if err != nil {
+		return nil, err
+	}
+	p.records = records
+	return p.w, nil
+}
+
+// rawFile returns the file that the server process writes its output into as is.
+// If w is not a file, start_server copies the output through a pipe,
+// so the destination can be switched by reopening or rotating log files.
+func (out *workerOutput) rawFile(w io.Writer) (*os.File, error) {
+	if f, ok := w.(*os.File); ok {
+		return f, nil
+	}
+	p, err := out.addPipe("", w)
+	if err != nil {
+		return nil, err
+	}
+	return p.w, nil
+}
+
+func (out *workerOutput) addPipe(stream string, dest io.Writer) (*outputPipe, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	p := &outputPipe{
+		r:      r,
+		w:      w,
+		stream: stream,
+		dest:   dest,
+	}
+	out.pipes = append(out.pipes, p)
+	return p, nil
+}
+
+// closeWriters closes the write ends of the pipes.
+// it should be called after the server process starts, because the process has their copies.
+func (out *workerOutput) closeWriters() {
+	for _, p := range out.pipes {
+		p.w.Close()
+	}
+}
+
+// closeReaders closes the read ends of the pipes.
+// it is used if the server process fails to start.
+func (out *workerOutput) closeReaders() {
+	for _, p := range out.pipes {
+		p.r.Close()
+	}
+}
+
+// copy starts copying the output of the server process.
+func (s *Starter) copyWorkerOutput(out *workerOutput, w *worker) {
+	for _, p := range out.pipes {
+		p := p
+		s.outputWg.Add(1)
+		if p.stream == "" {
+			go func() {
+				defer s.outputWg.Done()
+				defer p.r.Close()
+				io.Copy(p.dest, p.r)
+			}()
+			continue
+		}
+		go func() {
+			defer s.outputWg.Done()
+			defer p.r.Close()
+			s.copyLines(p, w.generation, w.Pid())
+		}()
+	}
+}
+
+// waitOutput waits for copying the output of the server processes.
+func (s *Starter) waitOutput(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		s.outputWg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+}
+
+// copyLines copies the output line by line with the prefix.
+func (s *Starter) copyLines(p *outputPipe, generation, pid int) {
+	r := bufio.NewReaderSize(p.r, maxLineLength)
+	for {
+		line, err := r.ReadSlice('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] == '\n' {
+				line = line[:len(line)-1]
+			}
+			if p.records {
+				p.dest.(recordWriter).WriteRecord(&logRecord{
+					time:       time.Now(),
+					generation: generation,
+					pid:        pid,
+					stream:     p.stream,
+					message:    string(line),
+				})
+			} else {
+				p.dest.Write(s.formatLine(time.Now(), generation, pid, p.stream, line))
+			}
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}
+
+type logEnvelope struct {
+	Time       string `json:"time"`
+	Generation int    `json:"generation,omitempty"`
+	Pid        int    `json:"pid"`
+	Stream     string `json:"stream"`
+	Message    string `json:"message"`
+}
+
+// formatLine formats a line of the output in LogFormat.
+func (s *Starter) formatLine(t time.Time, generation, pid int, stream string, line []byte) []byte {
+	timestamp := t.Format("2006-01-02T15:04:05.000Z07:00")
+	if s.LogFormat == "json" {
+		data, err := json.Marshal(logEnvelope{
+			Time:       timestamp,
+			Generation: generation,
+			Pid:        pid,
+			Stream:     stream,
+			Message:    string(line),
+		})
+		if err != nil {
+			// unreachable, logEnvelope can always be encoded.
+			panic(err)
+		}
+		return append(data, '\n')
+	}
+	return []byte(fmt.Sprintf("%s [%d:%d:%s] %s\n", timestamp, generation, pid, stream, line))
+}
+
+// asyncWriter returns the writer that writes into w in background.
+// the writers are shared by the server processes, and they are closed by closeAsyncWriters.
+func (s *Starter) asyncWriter(w io.Writer) io.Writer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.asyncWriters == nil {
+		s.asyncWriters = make(map[io.Writer]*asyncWriter)
+	}
+	if a, ok := s.asyncWriters[w]; ok {
+		return a
+	}
+	a := newAsyncWriter(w, outputQueueSize, s.formatLine)
+	s.asyncWriters[w] = a
+	return a
+}
+
+func (s *Starter) closeAsyncWriters() {
+	s.mu.Lock()
+	writers := s.asyncWriters
+	s.asyncWriters = nil
+	s.mu.Unlock()
+	for _, a := range writers {
+		a.Close()
+	}
+}
+
+// asyncWriter writes into the underlying writer in background.
+// If the underlying writer is slow, it drops the data instead of blocking the server processes.
+type asyncWriter struct {
+	w       io.Writer
+	mu      sync.RWMutex
+	closed  bool
+	ch      chan asyncItem
+	done    chan struct{}
+	dropped uint64
+
+	// format formats the report of the dropped lines in the same format as the other lines.
+	format func(t time.Time, generation, pid int, stream string, line []byte) []byte
+}
+
+// asyncItem is a queued data or a queued record.
+type asyncItem struct {
+	buf    []byte
+	record *logRecord
+}
+
+func newAsyncWriter(w io.Writer, size int, format func(t time.Time, generation, pid int, stream string, line []byte) []byte) *asyncWriter {
+	a := &asyncWriter{
+		w:      w,
+		ch:     make(chan asyncItem, size),
+		done:   make(chan struct{}),
+		format: format,
+	}
+	go a.run()
+	return a
+}
+
+func (a *asyncWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	if err := a.enqueue(asyncItem{buf: buf}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteRecord queues the record. The underlying writer must be a recordWriter.
+func (a *asyncWriter) WriteRecord(r *logRecord) error {
+	return a.enqueue(asyncItem{record: r})
+}
+
+func (a *asyncWriter) enqueue(item asyncItem) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return os.ErrClosed
+	}
+	select {
+	case a.ch <- item:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+	return nil
+}
+
+func (a *asyncWriter) run() {
+	defer close(a.done)
+	for item := range a.ch {
+		if n := atomic.SwapUint64(&a.dropped, 0); n > 0 {
+			a.writeDropped(n)
+		}
+		if item.record != nil {
+			a.w.(recordWriter).WriteRecord(item.record)
+		} else {
+			a.w.Write(item.buf)
+		}
+	}
+}
+
+// writeDropped reports the number of the dropped lines to the underlying writer.
+func (a *asyncWriter) writeDropped(n uint64) {
+	msg := fmt.Sprintf("dropped %d lines of the output because the log destination is too slow", n)
+	if w, ok := a.w.(recordWriter); ok {
+		w.WriteRecord(&logRecord{
+			time:    time.Now(),
+			pid:     os.Getpid(),
+			stream:  "start_server",
+			message: msg,
+		})
+		return
+	}
+	a.w.Write(a.format(time.Now(), 0, os.Getpid(), "start_server", []byte(msg)))
+}
+
+// Close flushes the queued data.
+func (a *asyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.ch)
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
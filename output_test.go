@@ -0,0 +1,226 @@
+package starter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestCopyLines(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf lockedBuffer
+	s := &Starter{}
+	p := &outputPipe{
+		r:      r,
+		w:      w,
+		stream: "stdout",
+		dest:   &buf,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.copyLines(p, 2, 1234)
+	}()
+
+	// partial lines are joined.
+	w.Write([]byte("hello "))
+	time.Sleep(100 * time.Millisecond)
+	w.Write([]byte("world\nfoo\nbar"))
+
+	// too long lines are split.
+	w.Write([]byte("\n" + strings.Repeat("a", maxLineLength+10) + "\n"))
+
+	// the last line without newline is flushed.
+	w.Write([]byte("the last line"))
+	w.Close()
+	<-done
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	messages := []string{"hello world", "foo", "bar", strings.Repeat("a", maxLineLength), strings.Repeat("a", 10), "the last line"}
+	if len(lines) != len(messages) {
+		t.Fatalf("want %d lines, got %d lines: %q", len(messages), len(lines), lines)
+	}
+	for i, line := range lines {
+		want := " [2:1234:stdout] " + messages[i]
+		if !strings.HasSuffix(line, want) {
+			t.Errorf("line %d: want suffix %q, got %q", i, want, line)
+		}
+	}
+}
+
+func TestFormatLine_JSON(t *testing.T) {
+	s := &Starter{LogFormat: "json"}
+	line := s.formatLine(time.Now(), 2, 1234, "stderr", []byte("hello\tworld"))
+	var v logEnvelope
+	if err := json.Unmarshal(line, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Generation != 2 || v.Pid != 1234 || v.Stream != "stderr" || v.Message != "hello\tworld" {
+		t.Errorf("unexpected envelope: %#v", v)
+	}
+}
+
+type blockingWriter struct {
+	lockedBuffer
+	unblock chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.lockedBuffer.Write(p)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	w := &blockingWriter{unblock: make(chan struct{})}
+	a := newAsyncWriter(w, 2, (&Starter{}).formatLine)
+
+	// the slow writer doesn't block writing.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			a.Write([]byte("line\n"))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("asyncWriter is blocked")
+	}
+
+	close(w.unblock)
+	a.Close()
+	if !strings.Contains(w.String(), "dropped") {
+		t.Errorf("want the message about dropped lines, got %q", w.String())
+	}
+	if _, err := a.Write([]byte("line\n")); err == nil {
+		t.Error("want error after close, got nil")
+	}
+}
+
+func TestAsyncWriter_JSON(t *testing.T) {
+	w := &blockingWriter{unblock: make(chan struct{})}
+	a := newAsyncWriter(w, 2, (&Starter{LogFormat: "json"}).formatLine)
+	for i := 0; i < 10; i++ {
+		a.Write([]byte(`{"message":"line"}` + "\n"))
+	}
+	close(w.unblock)
+	a.Close()
+
+	// the report of the dropped lines is also a JSON line.
+	for _, line := range strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n") {
+		var v map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Errorf("invalid JSON line %q: %v", line, err)
+		}
+	}
+	if !strings.Contains(w.String(), "dropped") {
+		t.Errorf("want the message about dropped lines, got %q", w.String())
+	}
+}
+
+func TestLogf_JSON(t *testing.T) {
+	f, err := ioutil.TempFile("", "server-starter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	stderr := os.Stderr
+	os.Stderr = f
+	defer func() { os.Stderr = stderr }()
+
+	// without log files, the lines are written into stderr without the prefix of the standard logger.
+	s := &Starter{LogFormat: "json"}
+	s.logf("hello %s", "world")
+	os.Stderr = stderr
+
+	got, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v logEnvelope
+	if err := json.Unmarshal(got, &v); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", got, err)
+	}
+	if v.Stream != "start_server" || v.Message != "hello world" {
+		t.Errorf("unexpected envelope: %#v", v)
+	}
+}
+
+func TestOpenWorkerOutput_Separate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Starter{
+		LogFile:    filepath.Join(dir, "all.log"),
+		StdoutLog:  filepath.Join(dir, "access.log"),
+		StderrLog:  filepath.Join(dir, "error.log"),
+		StarterLog: filepath.Join(dir, "all.log"),
+	}
+	if err := s.openLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.logSinks) != 3 {
+		t.Errorf("want 3 sinks, got %d", len(s.logSinks))
+	}
+
+	out, err := s.openWorkerOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.copyWorkerOutput(out, &worker{generation: 1})
+	out.stdout.Write([]byte("GET /\n"))
+	out.stderr.Write([]byte("something wrong\n"))
+	out.closeWriters()
+	s.logf("hello from start_server")
+	time.Sleep(100 * time.Millisecond)
+	for _, sink := range s.logSinks {
+		sink.Close()
+	}
+
+	files := map[string]string{
+		"access.log": "GET /\n",
+		"error.log":  "something wrong\n",
+		"all.log":    "hello from start_server\n",
+	}
+	for name, want := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: want %q, got %q", name, want, string(got))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package starter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseCPUList parses a list of CPUs, such as "0-3,8,10-11".
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		first, last := item, item
+		if idx := strings.IndexByte(item, '-'); idx >= 0 {
+			first, last = item[:idx], item[idx+1:]
+		}
+		begin, err := strconv.Atoi(first)
+		if err != nil || begin < 0 {
+			return nil, fmt.Errorf("invalid cpu number: %s", item)
+		}
+		end, err := strconv.Atoi(last)
+		if err != nil || end < begin {
+			return nil, fmt.Errorf("invalid cpu range: %s", item)
+		}
+		for i := begin; i <= end; i++ {
+			cpus = append(cpus, i)
+		}
+	}
+	if len(cpus) == 0 {
+		return nil, errors.New("no cpu specified")
+	}
+	return cpus, nil
+}
+
+// formatCPUList is the inverse of parseCPUList.
+func formatCPUList(cpus []int) string {
+	var b strings.Builder
+	for i := 0; i < len(cpus); i++ {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		if i == j {
+			fmt.Fprintf(&b, "%d", cpus[i])
+		} else {
+			fmt.Fprintf(&b, "%d-%d", cpus[i], cpus[j])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// procAttrString returns the attributes of the server processes for logging.
+func (s *Starter) procAttrString() string {
+	var attrs []string
+	if s.Nice != nil {
+		attrs = append(attrs, fmt.Sprintf("nice=%d", *s.Nice))
+	}
+	if s.OOMScoreAdj != nil {
+		attrs = append(attrs, fmt.Sprintf("oom_score_adj=%d", *s.OOMScoreAdj))
+	}
+	if len(s.CPUAffinity) > 0 {
+		attrs = append(attrs, "cpu_affinity="+formatCPUList(s.CPUAffinity))
+	}
+	if s.Umask != nil {
+		attrs = append(attrs, fmt.Sprintf("umask=%04o", *s.Umask))
+	}
+	for _, l := range s.Rlimits {
+		attrs = append(attrs, "rlimit_"+l.String())
+	}
+	if len(attrs) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(attrs, ", ") + ")"
+}
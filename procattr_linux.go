@@ -0,0 +1,71 @@
+package starter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// checkProcAttr returns an error if the scheduling attributes can't be applied.
+func (s *Starter) checkProcAttr() error {
+	return nil
+}
+
+// setProcAttr sets the scheduling attributes of the current thread.
+// it is called by the pre-exec helper on the thread that executes the server program,
+// and the threads of the server program inherit them.
+func setProcAttr(attr *execAttr) error {
+	if attr.OOMScoreAdj != nil {
+		if err := setOOMScoreAdj(os.Getpid(), *attr.OOMScoreAdj); err != nil {
+			return err
+		}
+	}
+	if attr.Nice != nil {
+		// the nice value is the attribute of threads on Linux,
+		// and zero means the calling thread.
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *attr.Nice); err != nil {
+			return fmt.Errorf("failed to set nice %d: %s", *attr.Nice, err)
+		}
+	}
+	if len(attr.CPUAffinity) > 0 {
+		if err := setCPUAffinity(0, attr.CPUAffinity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setOOMScoreAdj(pid int, adj int) error {
+	path := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(adj)), 0644); err != nil {
+		return fmt.Errorf("failed to set oom_score_adj %d: %s", adj, err)
+	}
+	return nil
+}
+
+// cpuSet is same as cpu_set_t in C, and it can hold 1024 CPUs.
+type cpuSet [16]uint64
+
+func setCPUAffinity(tid int, cpus []int) error {
+	var set cpuSet
+	for _, cpu := range cpus {
+		if cpu >= len(set)*64 {
+			return fmt.Errorf("cpu %d is out of range", cpu)
+		}
+		set[cpu/64] |= 1 << uint(cpu%64)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid), unsafe.Sizeof(set), uintptr(unsafe.Pointer(&set)))
+	if errno != 0 {
+		return fmt.Errorf("failed to set cpu affinity %s: %s", formatCPUList(cpus), errno)
+	}
+	return nil
+}
+
+// selfExecutable returns the path of start_server for the pre-exec helper.
+// /proc/self/exe works even if the binary is replaced by the hot upgrade.
+func selfExecutable() (string, error) {
+	return "/proc/self/exe", nil
+}
@@ -0,0 +1,45 @@
+//go:build !linux
+// +build !linux
+
+package starter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkProcAttr returns an error if the scheduling attributes can't be applied.
+func (s *Starter) checkProcAttr() error {
+	if s.OOMScoreAdj != nil {
+		return errors.New("--oom-score-adj is not supported on this platform")
+	}
+	if s.StarterOOMScoreAdj != nil {
+		return errors.New("--starter-oom-score-adj is not supported on this platform")
+	}
+	if len(s.CPUAffinity) > 0 {
+		return errors.New("--cpu-affinity is not supported on this platform")
+	}
+	return nil
+}
+
+// setProcAttr sets the scheduling attributes of the current process.
+// it is called by the pre-exec helper, and the server program inherits them.
+func setProcAttr(attr *execAttr) error {
+	if attr.Nice != nil {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *attr.Nice); err != nil {
+			return fmt.Errorf("failed to set nice %d: %s", *attr.Nice, err)
+		}
+	}
+	return nil
+}
+
+func setOOMScoreAdj(pid int, adj int) error {
+	return errors.New("--starter-oom-score-adj is not supported on this platform")
+}
+
+// selfExecutable returns the path of start_server for the pre-exec helper.
+func selfExecutable() (string, error) {
+	return os.Executable()
+}
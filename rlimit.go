@@ -0,0 +1,65 @@
+package starter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RlimInfinity is the value of no limit on a resource.
+const RlimInfinity = ^uint64(0)
+
+// Rlimit is a resource limit for the server processes.
+type Rlimit struct {
+	// Resource is the name of the resource: "nofile", "core", "nproc" or "as".
+	Resource string
+
+	// Cur is the soft limit.
+	Cur uint64
+
+	// Max is the hard limit.
+	Max uint64
+}
+
+func (r Rlimit) String() string {
+	return fmt.Sprintf("%s=%s:%s", r.Resource, formatRlimValue(r.Cur), formatRlimValue(r.Max))
+}
+
+// parseRlimit parses the value of --rlimit-* options.
+// the format is "limit" or "soft:hard", and "unlimited" means no limit.
+func parseRlimit(resource, value string) (Rlimit, error) {
+	soft, hard := value, value
+	if idx := strings.IndexByte(value, ':'); idx >= 0 {
+		soft, hard = value[:idx], value[idx+1:]
+	}
+	cur, err := parseRlimValue(soft)
+	if err != nil {
+		return Rlimit{}, err
+	}
+	max, err := parseRlimValue(hard)
+	if err != nil {
+		return Rlimit{}, err
+	}
+	if cur > max {
+		return Rlimit{}, fmt.Errorf("the soft limit %s exceeds the hard limit %s", soft, hard)
+	}
+	return Rlimit{
+		Resource: resource,
+		Cur:      cur,
+		Max:      max,
+	}, nil
+}
+
+func parseRlimValue(s string) (uint64, error) {
+	switch s {
+	case "unlimited", "infinity":
+		return RlimInfinity, nil
+	}
+	return parseSize(s)
+}
+
+func formatRlimValue(v uint64) string {
+	if v == RlimInfinity {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", v)
+}
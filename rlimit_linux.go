@@ -0,0 +1,37 @@
+package starter
+
+import (
+	"fmt"
+	"syscall"
+)
+
+var rlimitResources = map[string]int{
+	"nofile": syscall.RLIMIT_NOFILE,
+	"core":   syscall.RLIMIT_CORE,
+	"nproc":  rlimitNproc,
+	"as":     syscall.RLIMIT_AS,
+}
+
+// checkRlimits returns an error if the resource limits can't be applied.
+func checkRlimits(limits []Rlimit) error {
+	return nil
+}
+
+// setRlimits sets the resource limits of the current process.
+// it is called by the pre-exec helper, so the limits of start_server itself are never changed.
+func setRlimits(limits []Rlimit) error {
+	for _, l := range limits {
+		resource, ok := rlimitResources[l.Resource]
+		if !ok {
+			return fmt.Errorf("unknown resource: %s", l.Resource)
+		}
+		rlim := syscall.Rlimit{
+			Cur: l.Cur,
+			Max: l.Max,
+		}
+		if err := syscall.Setrlimit(resource, &rlim); err != nil {
+			return fmt.Errorf("failed to set rlimit %s: %s", l, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package starter
+
+// the syscall package doesn't define RLIMIT_NPROC on linux.
+const rlimitNproc = 0x6
@@ -0,0 +1,9 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package starter
+
+// the syscall package doesn't define RLIMIT_NPROC on linux.
+// the resource numbers of mips are different from the other architectures.
+const rlimitNproc = 0x8
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package starter
+
+import "errors"
+
+// checkRlimits returns an error if the resource limits can't be applied.
+func checkRlimits(limits []Rlimit) error {
+	if len(limits) == 0 {
+		return nil
+	}
+	return errors.New("--rlimit-* options are not supported on this platform")
+}
+
+func setRlimits(limits []Rlimit) error {
+	return checkRlimits(limits)
+}
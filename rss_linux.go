@@ -0,0 +1,109 @@
+package starter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readRSS returns the resident set size of the process in bytes.
+// If children is true, the sizes of its descendants are included.
+func readRSS(pid int, children bool) (uint64, error) {
+	rss, err := readProcRSS(pid)
+	if err != nil {
+		return 0, err
+	}
+	if !children {
+		return rss, nil
+	}
+	for _, child := range listDescendants(pid) {
+		size, err := readProcRSS(child)
+		if err != nil {
+			continue // the process may have exited
+		}
+		rss += size
+	}
+	return rss, nil
+}
+
+// readProcRSS reads VmRSS from /proc/<pid>/status.
+func readProcRSS(pid int) (uint64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "VmRSS:") {
+			continue
+		}
+		// the format is "VmRSS:	   1234 kB"
+		fields := strings.Fields(line[len("VmRSS:"):])
+		if len(fields) == 0 {
+			break
+		}
+		kb, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	// kernel threads and zombies have no VmRSS.
+	return 0, nil
+}
+
+// listDescendants returns the process ids of all descendants of the process.
+func listDescendants(pid int) []int {
+	infos, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	// build the process tree from /proc/<pid>/stat.
+	children := map[int][]int{}
+	for _, info := range infos {
+		p, err := strconv.Atoi(info.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", p))
+		if err != nil {
+			continue
+		}
+		// the format is "pid (comm) state ppid ...", and comm may contain spaces.
+		idx := bytes.LastIndexByte(stat, ')')
+		if idx < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[idx+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		children[ppid] = append(children[ppid], p)
+	}
+
+	var descendants []int
+	queue := children[pid]
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		descendants = append(descendants, p)
+		queue = append(queue, children[p]...)
+	}
+	return descendants
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package starter
+
+import "errors"
+
+// readRSS returns the resident set size of the process in bytes.
+func readRSS(pid int, children bool) (uint64, error) {
+	return 0, errors.New("--max-rss is not supported on this platform")
+}
@@ -1,6 +1,7 @@
 package starter
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -14,20 +15,42 @@ type signalName struct {
 
 var signalNameTable []signalName
 
+// maxSignal is the largest signal number of the platform, NSIG - 1.
+// the platform specific files override it.
+var maxSignal = 31
+
 func nameToSignal(name string) os.Signal {
 	name = strings.ToUpper(name)
-	name = strings.TrimPrefix("SIG", name)
+	name = strings.TrimPrefix(name, "SIG")
 	for _, sn := range signalNameTable {
 		if sn.Name == name {
 			return sn.Signal
 		}
 	}
-	if n, err := strconv.Atoi(name); err != nil {
+	if n, err := strconv.Atoi(name); err == nil && n > 0 && n <= maxSignal {
 		return syscall.Signal(n)
 	}
 	return nil
 }
 
+// parseForwardSignals parses the comma separated list of signals for --forward-signal.
+func parseForwardSignals(value string) ([]os.Signal, error) {
+	var signals []os.Signal
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		sig := nameToSignal(name)
+		if sig == nil {
+			return nil, fmt.Errorf("unknown signal name for --forward-signal: %s", name)
+		}
+		switch sig {
+		case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGSTOP, syscall.SIGCHLD:
+			return nil, fmt.Errorf("%s cannot be forwarded", signalToName(sig))
+		}
+		signals = append(signals, sig)
+	}
+	return signals, nil
+}
+
 func signalToName(signal os.Signal) string {
 	if signal == nil {
 		return "<nil>"
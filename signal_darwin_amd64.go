@@ -3,6 +3,7 @@ package starter
 import "syscall"
 
 func init() {
+	maxSignal = 31
 	signalNameTable = append(signalNameTable,
 		// cat zerrors_darwin_amd64.go | perl -nle 'print "signalName{syscall.SIG$1, \"$1\"}," if /SIG(\w+)\s*=\s*Signal/'
 		signalName{syscall.SIGABRT, "ABRT"},
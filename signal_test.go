@@ -0,0 +1,28 @@
+package starter
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestNameToSignal(t *testing.T) {
+	tests := []struct {
+		name string
+		want os.Signal
+	}{
+		{"TERM", syscall.SIGTERM},
+		{"SIGTERM", syscall.SIGTERM},
+		{"sigterm", syscall.SIGTERM},
+		{"15", syscall.SIGTERM},
+		{"0", nil},
+		{"-1", nil},
+		{"1000", nil},
+		{"UNKNOWN", nil},
+	}
+	for _, tt := range tests {
+		if got := nameToSignal(tt.name); got != tt.want {
+			t.Errorf("nameToSignal(%q): want %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package starter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// portOption is a parsed --port option, e.g. "0.0.0.0:443?reuseport&fastopen=256&rcvbuf=4M".
+type portOption struct {
+	// "tcp", "tcp4", "tcp6", "udp", "udp4" or "udp6"
+	network string
+
+	// host:port
+	address string
+
+	// the socket options set before the socket is bound.
+	sockopts []sockopt
+}
+
+// sockopt is a socket option of --port.
+type sockopt struct {
+	name  string
+	level int
+	opt   int
+	value int
+}
+
+// sockoptDef is the definition of a socket option of --port.
+type sockoptDef struct {
+	level   int
+	opt     int
+	tcpOnly bool
+	parse   func(value string) (int, error)
+}
+
+// knownSockopts is the socket options that --port accepts on some platform.
+var knownSockopts = []string{
+	"reuseport",
+	"nodelay",
+	"keepalive",
+	"fastopen",
+	"defer-accept",
+	"v6only",
+	"rcvbuf",
+	"sndbuf",
+}
+
+func parsePortOption(value string) (*portOption, error) {
+	hostport := value
+	var query url.Values
+	if idx := strings.IndexByte(value, '?'); idx >= 0 {
+		hostport = value[:idx]
+		var err error
+		query, err = url.ParseQuery(value[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", value, err)
+		}
+	}
+	if strings.IndexByte(hostport, '=') >= 0 {
+		return nil, errors.New("fd options are not supported")
+	}
+
+	suffix := ""
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// try to parse the hostport as a port number
+		// by default, only bind to IPv4 (for compatibility)
+		host = "0.0.0.0"
+		port = hostport
+		suffix = "4"
+	}
+	if _, err := parsePortRange(port); err != nil {
+		return nil, err
+	}
+	network := "tcp"
+	if strings.HasPrefix(port, "u") {
+		network = "udp"
+		port = strings.TrimPrefix(port, "u")
+	}
+	p := &portOption{
+		network: network + suffix,
+		address: net.JoinHostPort(host, port),
+	}
+
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		v := values[len(values)-1]
+		def, ok := sockoptDefs[name]
+		if !ok {
+			if isKnownSockopt(name) {
+				return nil, fmt.Errorf("%s: %s is not supported on this platform", value, name)
+			}
+			return nil, fmt.Errorf("%s: unknown socket option: %s", value, name)
+		}
+		if def.tcpOnly && network != "tcp" {
+			return nil, fmt.Errorf("%s: %s is available only for TCP", value, name)
+		}
+		if name == "v6only" {
+			// the wildcard address "0.0.0.0" is bound by an IPv6 socket, which accepts IPv4 too.
+			if ip := net.ParseIP(host); suffix == "4" || ip != nil && ip.To4() != nil && !ip.IsUnspecified() {
+				return nil, fmt.Errorf("%s: v6only is available only for IPv6 addresses", value)
+			}
+		}
+		n, err := def.parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s value: %v", value, name, err)
+		}
+		p.sockopts = append(p.sockopts, sockopt{
+			name:  name,
+			level: def.level,
+			opt:   def.opt,
+			value: n,
+		})
+	}
+	return p, nil
+}
+
+func isKnownSockopt(name string) bool {
+	for _, known := range knownSockopts {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// control sets the socket options, it is used as net.ListenConfig.Control.
+func (p *portOption) control(network, address string, c syscall.RawConn) error {
+	var err error
+	cerr := c.Control(func(fd uintptr) {
+		for _, o := range p.sockopts {
+			if err = syscall.SetsockoptInt(int(fd), o.level, o.opt, o.value); err != nil {
+				err = fmt.Errorf("failed to set %s: %v", o.name, err)
+				return
+			}
+		}
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// parseSockoptBool parses the value of a boolean option.
+// the option without the value, e.g. "?reuseport", means true.
+func parseSockoptBool(s string) (int, error) {
+	if s == "" {
+		return 1, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid format: %s", s)
+	}
+	if b {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// parseSockoptInt parses the value of an integer option, such as the queue length.
+func parseSockoptInt(s string) (int, error) {
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid format: %s", s)
+	}
+	return int(n), nil
+}
+
+// parseSockoptSize parses the value of a buffer size option, such as "4M".
+func parseSockoptSize(s string) (int, error) {
+	n, err := parseSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if n > 1<<31-1 {
+		return 0, fmt.Errorf("too large: %s", s)
+	}
+	return int(n), nil
+}
+
+// parseSockoptSeconds parses the value of a timeout option in seconds, such as "5" or "5s".
+func parseSockoptSeconds(s string) (int, error) {
+	d, err := parseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 || d > (1<<31-1)*time.Second {
+		return 0, fmt.Errorf("out of range: %s", s)
+	}
+	return int(d / time.Second), nil
+}
@@ -0,0 +1,20 @@
+package starter
+
+import "syscall"
+
+// the syscall package doesn't define them on linux.
+const (
+	soReusePort = 0xf
+	tcpFastOpen = 0x17
+)
+
+var sockoptDefs = map[string]sockoptDef{
+	"reuseport":    {level: syscall.SOL_SOCKET, opt: soReusePort, parse: parseSockoptBool},
+	"nodelay":      {level: syscall.IPPROTO_TCP, opt: syscall.TCP_NODELAY, tcpOnly: true, parse: parseSockoptBool},
+	"keepalive":    {level: syscall.SOL_SOCKET, opt: syscall.SO_KEEPALIVE, tcpOnly: true, parse: parseSockoptBool},
+	"fastopen":     {level: syscall.IPPROTO_TCP, opt: tcpFastOpen, tcpOnly: true, parse: parseSockoptInt},
+	"defer-accept": {level: syscall.IPPROTO_TCP, opt: syscall.TCP_DEFER_ACCEPT, tcpOnly: true, parse: parseSockoptSeconds},
+	"v6only":       {level: syscall.IPPROTO_IPV6, opt: syscall.IPV6_V6ONLY, parse: parseSockoptBool},
+	"rcvbuf":       {level: syscall.SOL_SOCKET, opt: syscall.SO_RCVBUF, parse: parseSockoptSize},
+	"sndbuf":       {level: syscall.SOL_SOCKET, opt: syscall.SO_SNDBUF, parse: parseSockoptSize},
+}
@@ -0,0 +1,52 @@
+package starter
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestPortOption_Control(t *testing.T) {
+	p, err := parsePortOption("127.0.0.1:0?reuseport&fastopen=256&defer-accept=5&rcvbuf=256K")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := net.ListenConfig{
+		Control: p.control,
+	}
+	l, err := lc.Listen(context.Background(), p.network, p.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	rc, err := l.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	getsockopt := func(level, opt int) int {
+		var v int
+		var err error
+		rc.Control(func(fd uintptr) {
+			v, err = syscall.GetsockoptInt(int(fd), level, opt)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v := getsockopt(syscall.SOL_SOCKET, soReusePort); v != 1 {
+		t.Errorf("want reuseport is 1, got %d", v)
+	}
+	if v := getsockopt(syscall.IPPROTO_TCP, tcpFastOpen); v != 256 {
+		t.Errorf("want fastopen is 256, got %d", v)
+	}
+	if v := getsockopt(syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT); v <= 0 {
+		t.Errorf("want defer-accept is enabled, got %d", v)
+	}
+	// the kernel doubles the value of SO_RCVBUF.
+	if v := getsockopt(syscall.SOL_SOCKET, syscall.SO_RCVBUF); v < 256<<10 {
+		t.Errorf("want rcvbuf is at least 256K, got %d", v)
+	}
+}
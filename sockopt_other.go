@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package starter
+
+import "syscall"
+
+// fastopen and defer-accept are not supported on this platform.
+var sockoptDefs = map[string]sockoptDef{
+	"reuseport": {level: syscall.SOL_SOCKET, opt: syscall.SO_REUSEPORT, parse: parseSockoptBool},
+	"nodelay":   {level: syscall.IPPROTO_TCP, opt: syscall.TCP_NODELAY, tcpOnly: true, parse: parseSockoptBool},
+	"keepalive": {level: syscall.SOL_SOCKET, opt: syscall.SO_KEEPALIVE, tcpOnly: true, parse: parseSockoptBool},
+	"v6only":    {level: syscall.IPPROTO_IPV6, opt: syscall.IPV6_V6ONLY, parse: parseSockoptBool},
+	"rcvbuf":    {level: syscall.SOL_SOCKET, opt: syscall.SO_RCVBUF, parse: parseSockoptSize},
+	"sndbuf":    {level: syscall.SOL_SOCKET, opt: syscall.SO_SNDBUF, parse: parseSockoptSize},
+}
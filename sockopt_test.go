@@ -0,0 +1,87 @@
+package starter
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestParsePortOption(t *testing.T) {
+	tests := []struct {
+		in   string
+		want portOption
+	}{
+		{
+			in:   "8080",
+			want: portOption{network: "tcp4", address: "0.0.0.0:8080"},
+		},
+		{
+			in:   "u8080",
+			want: portOption{network: "udp4", address: "0.0.0.0:8080"},
+		},
+		{
+			in:   "[::1]:8080",
+			want: portOption{network: "tcp", address: "[::1]:8080"},
+		},
+		{
+			in: "127.0.0.1:8080?sndbuf=64K&rcvbuf=4M",
+			want: portOption{
+				network: "tcp",
+				address: "127.0.0.1:8080",
+				sockopts: []sockopt{
+					{name: "rcvbuf", level: syscall.SOL_SOCKET, opt: syscall.SO_RCVBUF, value: 4 << 20},
+					{name: "sndbuf", level: syscall.SOL_SOCKET, opt: syscall.SO_SNDBUF, value: 64 << 10},
+				},
+			},
+		},
+		{
+			in: "127.0.0.1:8080?keepalive=0&nodelay=false",
+			want: portOption{
+				network: "tcp",
+				address: "127.0.0.1:8080",
+				sockopts: []sockopt{
+					{name: "keepalive", level: syscall.SOL_SOCKET, opt: syscall.SO_KEEPALIVE, value: 0},
+					{name: "nodelay", level: syscall.IPPROTO_TCP, opt: syscall.TCP_NODELAY, value: 0},
+				},
+			},
+		},
+		{
+			in: "[::]:8080?v6only",
+			want: portOption{
+				network: "tcp",
+				address: "[::]:8080",
+				sockopts: []sockopt{
+					{name: "v6only", level: syscall.IPPROTO_IPV6, opt: syscall.IPV6_V6ONLY, value: 1},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parsePortOption(tt.in)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: want %#v, got %#v", tt.in, tt.want, *got)
+		}
+	}
+
+	errors := []string{
+		"8080=3",
+		"8080?unknown",
+		"8080?rcvbuf=foo",
+		"8080?rcvbuf=4G",
+		"8080?reuseport=maybe",
+		"u8080?nodelay",
+		"8080?v6only",
+		"127.0.0.1:8080?v6only",
+		"8001-8000",
+		"127.0.0.1:u8000-?reuseport",
+	}
+	for _, in := range errors {
+		if _, err := parsePortOption(in); err == nil {
+			t.Errorf("%s: want error, got nil", in)
+		}
+	}
+}
@@ -31,6 +31,10 @@ type socket interface {
 // PortEnvName is the environment name for server_starter configures.
 const PortEnvName = "SERVER_STARTER_PORT"
 
+// PortNamesEnvName is the environment name for the names of the sockets,
+// e.g. "admin=3;web=4". The format is the same as SERVER_STARTER_PORT, but the names are used instead of the addresses.
+const PortNamesEnvName = "SERVER_STARTER_PORT_NAMES"
+
 // GenerationEnvName is the environment name for the generation number.
 const GenerationEnvName = "SERVER_STARTER_GENERATION"
 
@@ -40,11 +44,22 @@ type Starter struct {
 	Args    []string
 
 	// Ports to bind to (addr:port or port, so it's a string)
+	// The socket can be named by the prefix, e.g. "admin@127.0.0.1:9000".
+	// The port can be a range, e.g. "8000-8015", and the host name binds all of its addresses.
+	// The socket options can be set by the query, e.g. "0.0.0.0:443?reuseport&fastopen=256&rcvbuf=4M".
 	Ports []string
 
 	// Paths at where to listen using unix socket.
+	// The permission and the owner can be set by the query, e.g. "/tmp/app.sock?mode=0660&owner=app&group=www".
+	// The path that starts with '@' is an abstract unix socket on Linux.
+	// The path prefixed by "unixgram:" or "unixpacket:" binds the socket of the type.
 	Paths []string
 
+	// if set, reads additional --port and --path options from the file, one option per line.
+	// The file is read again when start_server reloads the server,
+	// so the sockets can be added and removed without restarting start_server.
+	ListenFile string
+
 	Interval time.Duration
 
 	// Signal to send when HUP is received
@@ -53,6 +68,24 @@ type Starter struct {
 	// Signal to send when TERM is received
 	SignalOnTERM os.Signal
 
+	// Signals to be relayed to the server processes of the newest generation.
+	ForwardSignals []os.Signal
+
+	// if set, relays ForwardSignals to the server processes of all generations.
+	ForwardSignalToAll bool
+
+	// if set, start_server re-executes its binary when it receives the signal,
+	// and hands over the listening sockets to the new start_server.
+	UpgradeSignal os.Signal
+
+	// if set, start_server listens on the unix socket at the path,
+	// and hands over the listening sockets to another start_server that connects to it with Takeover.
+	HandoverSocket string
+
+	// if set, start_server takes over the listening sockets from the start_server
+	// that listens on the unix socket at the path, and stops it after the first generation starts.
+	Takeover string
+
 	// KillOlddeplay is time to suspend to send a signal to the old worker.
 	KillOldDelay time.Duration
 
@@ -71,9 +104,57 @@ type Starter struct {
 	// automatic restart interval (default 360). It is used with EnableAutoRestart option.
 	AutoRestartInterval time.Duration
 
+	// if set, spawns a new worker when the resident set size of the newest generation exceeds it.
+	// the size is in bytes. (Linux only)
+	MaxRSS uint64
+
+	// the period for which the resident set size must exceed MaxRSS (default 30s).
+	MaxRSSPeriod time.Duration
+
+	// if set, the resident set size includes the descendants of the worker.
+	MaxRSSIncludeChildren bool
+
+	// if set, the server process must touch the file specified by SERVER_STARTER_HEARTBEAT_FILE every HeartbeatInterval.
+	// start_server spawns a new worker if the newest generation misses HeartbeatMisses heartbeats.
+	HeartbeatInterval time.Duration
+
+	// the number of missed heartbeats to consider the worker hung (default 3).
+	HeartbeatMisses int
+
+	// if set, spawns a new worker when the command or the files are changed.
+	// If the path is a directory, the files in the directory are watched.
+	Watch []string
+
+	// the time to wait for the watched files to stop changing (default 1s).
+	WatchDelay time.Duration
+
+	// development mode: runs Build and spawns a new worker when the files are changed.
+	// If the path ends with "/...", the files in the directory are watched recursively.
+	DevWatch []string
+
+	// the command to build the server program in development mode.
+	// start_server spawns a new worker if and only if the build succeeds.
+	Build string
+
 	// directory that contains environment variables to the server processes.
+	// It is compatible with envdir of daemontools.
 	EnvDir string
 
+	// if set, spawns a new worker when the contents of EnvDir are changed.
+	WatchEnvDir bool
+
+	// environment variables to the server processes, in the form "KEY=VALUE".
+	Env []string
+
+	// files in dotenv format that contain environment variables to the server processes.
+	EnvFiles []string
+
+	// if set, the server processes don't inherit the environment variables of start_server except PassEnv.
+	ClearEnv bool
+
+	// names of the environment variables to be passed to the server processes when ClearEnv is set.
+	PassEnv []string
+
 	// prints the version number
 	Version bool
 
@@ -84,8 +165,55 @@ type Starter struct {
 	Daemonize bool
 
 	// if set, redirects STDOUT and STDERR to given file or command
+	// If LogFile is a file, start_server reopens it when it receives SIGUSR1.
+	// If LogFile is a command, start_server restarts it when it exits.
+	// "syslog://" and "journald://" send the logs to the local syslog daemon and systemd-journald.
 	LogFile string
 
+	// if set, redirects STDOUT of the server processes to given file or command instead of LogFile.
+	StdoutLog string
+
+	// if set, redirects STDERR of the server processes to given file or command instead of LogFile.
+	StderrLog string
+
+	// if set, redirects the messages of start_server itself to given file or command instead of LogFile.
+	StarterLog string
+
+	// if set, prefixes each line of the output of the server processes with
+	// the timestamp, the generation, the process id and the stream name.
+	LogPrefix bool
+
+	// the format of the prefixed output, "text" (default) or "json".
+	LogFormat string
+
+	// if set, rotates the log file when its size exceeds LogMaxSize in bytes.
+	LogMaxSize uint64
+
+	// if set, rotates the log file when it has been opened for LogMaxAge.
+	LogMaxAge time.Duration
+
+	// the number of the rotated log files to keep. zero means keeping all files.
+	LogMaxBackups int
+
+	// resource limits for the server processes.
+	// start_server applies them to each server process, and its own limits are not changed.
+	Rlimits []Rlimit
+
+	// the nice value of the server processes (optional)
+	Nice *int
+
+	// the oom_score_adj of the server processes (optional, Linux only)
+	OOMScoreAdj *int
+
+	// the oom_score_adj of start_server itself (optional, Linux only)
+	StarterOOMScoreAdj *int
+
+	// the CPUs on which the server processes are eligible to run (optional, Linux only)
+	CPUAffinity []int
+
+	// the umask of the server processes (optional)
+	Umask *int
+
 	// this is a wrapper command that reads the pid of the start_server process from --pid-file,
 	// sends SIGHUP to the process and waits until the server(s) of the older generation(s) die by monitoring the contents of the --status-file
 	Restart bool
@@ -93,16 +221,70 @@ type Starter struct {
 	// this is a wrapper command that reads the pid of the start_server process from --pid-file, sends SIGTERM to the process.
 	Stop bool
 
+	// this is a wrapper command that reads the pid of the start_server process from --pid-file, sends SIGUSR1 to the process.
+	ReopenLogs bool
+
+	// this is a wrapper command that reads the pid of the start_server process from --pid-file,
+	// sends UpgradeSignal to the process and waits until the new start_server takes over the --pid-file.
+	Upgrade bool
+
 	Logger   *log.Logger
 	mylogger *log.Logger
 	logfile  io.WriteCloser
 
+	// the destinations of the output of the server processes.
+	// nil means the stdout and the stderr of start_server.
+	stdoutLog io.Writer
+	stderrLog io.Writer
+
+	// the log files and the log commands, keyed by their specs.
+	logSinks map[string]io.WriteCloser
+
 	sockets    []socket
 	generation int
 	ctx        context.Context
 	cancel     context.CancelFunc
 	pidFile    *os.File
 
+	// the sockets in the current configuration, in the same order as sockets.
+	listenSockets []*listenSocket
+
+	// the state passed by the old start_server, and the sockets not bound yet.
+	upgradeState     *upgradeState
+	inheritedSockets map[string]socket
+
+	// handedOver is true if the new start_server takes over the sockets.
+	handedOver atomicBool
+
+	// handoverPending is true while the reload lock is held for the new start_server.
+	// the server processes that die unexpectedly are restarted without the lock.
+	handoverPending atomicBool
+
+	// reloadQueued is true while a reload requested by the watchers waits for the reload lock.
+	reloadQueued atomicBool
+
+	// keepPidFile is true if the new start_server takes over the pid file.
+	keepPidFile bool
+
+	// pidFileInherited is true while the pid file passed by the old start_server still has its pid.
+	pidFileInherited atomicBool
+
+	// the listener of HandoverSocket, and the connection to the start_server of Takeover.
+	handoverListener *net.UnixListener
+	handoverStat     os.FileInfo
+	takeoverConn     *handoverConn
+
+	heartbeatDir string
+
+	// the writers that write the prefixed output in background.
+	asyncWriters map[io.Writer]*asyncWriter
+
+	// the goroutines that copy the output of the server processes.
+	outputWg sync.WaitGroup
+
+	// the environment values of the newest generation.
+	lastEnv map[string]string
+
 	wg          sync.WaitGroup
 	mu          sync.RWMutex
 	shutdown    atomicBool
@@ -129,15 +311,64 @@ func (s *Starter) Run() error {
 	if s.Stop {
 		return s.stop()
 	}
+	if s.ReopenLogs {
+		return s.reopenLogs()
+	}
+	if s.Upgrade {
+		return s.upgradeStarter()
+	}
 	if s.Daemonize {
 		s.logf("WARNING: --daemonize is UNIMPLEMENTED")
 	}
 	if s.Command == "" {
 		return errors.New("command is required")
 	}
+	if err := checkRlimits(s.Rlimits); err != nil {
+		return err
+	}
+	if err := s.checkProcAttr(); err != nil {
+		return err
+	}
+	for _, path := range s.EnvFiles {
+		if _, err := loadDotEnv(path); err != nil {
+			return fmt.Errorf("failed to load env file %s: %s", path, err)
+		}
+	}
 	if err := s.openLogFile(); err != nil {
 		return err
 	}
+	state, err := takeUpgradeState()
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		// the pipe and the pid file must not leak to the server processes.
+		syscall.CloseOnExec(state.Ready)
+		if state.PidFile != 0 {
+			syscall.CloseOnExec(state.PidFile)
+		}
+		s.logf("taking over the sockets from start_server %d, generation %d", state.Pid, state.Generation)
+		if err := s.inheritSockets(state); err != nil {
+			return err
+		}
+		s.upgradeState = state
+		s.generation = state.Generation
+	} else if s.Takeover != "" {
+		// the pid file of the other start_server can't be taken over,
+		// so check it before taking the sockets.
+		if err := s.openPidFile(); err != nil {
+			return err
+		}
+		if err := s.takeover(); err != nil {
+			s.closePidFile()
+			return err
+		}
+	}
+	if s.StarterOOMScoreAdj != nil {
+		if err := setOOMScoreAdj(os.Getpid(), *s.StarterOOMScoreAdj); err != nil {
+			return err
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	s.ctx = ctx
@@ -152,6 +383,27 @@ func (s *Starter) Run() error {
 	if s.EnableAutoRestart {
 		go s.autoRestarter()
 	}
+	if err := s.openHeartbeatDir(); err != nil {
+		return err
+	}
+	if s.HeartbeatInterval > 0 {
+		go s.heartbeatWatcher()
+	}
+	if len(s.Watch) > 0 {
+		go s.fileWatcher()
+	}
+	if len(s.DevWatch) > 0 {
+		go s.devWatcher()
+	}
+	if s.WatchEnvDir && s.EnvDir != "" {
+		go s.envDirWatcher()
+	}
+	if s.MaxRSS > 0 {
+		if _, err := readRSS(os.Getpid(), false); err != nil {
+			return err
+		}
+		go s.rssWatcher()
+	}
 
 	if err := s.openPidFile(); err != nil {
 		return err
@@ -163,6 +415,11 @@ func (s *Starter) Run() error {
 		}
 		return err
 	}
+	s.closeInheritedSockets()
+
+	if len(s.DevWatch) > 0 && !s.build() {
+		s.logf("starting the server program built previously")
+	}
 
 	// start first generation
 	w, err := s.startWorker()
@@ -173,6 +430,22 @@ func (s *Starter) Run() error {
 		return err
 	}
 	w.Watch()
+	if s.upgradeState != nil {
+		s.notifyReady(s.upgradeState)
+		s.ownInheritedFiles()
+	}
+	if s.takeoverConn != nil {
+		if err := s.drainOld(); err != nil {
+			s.logf("handover: failed to drain the old start_server: %s", err)
+		} else {
+			s.ownInheritedFiles()
+		}
+	}
+	if s.HandoverSocket != "" {
+		if err := s.listenHandover(); err != nil {
+			return err
+		}
+	}
 
 	// enable reload
 	s.unlockReload()
@@ -182,9 +455,12 @@ func (s *Starter) Run() error {
 }
 
 func (s *Starter) openPidFile() error {
-	if s.PidFile == "" {
+	if s.PidFile == "" || s.pidFile != nil {
 		return nil
 	}
+	if s.upgradeState != nil && s.upgradeState.PidFile != 0 {
+		return s.takePidFile(s.upgradeState.PidFile)
+	}
 	f, err := os.OpenFile(s.PidFile, os.O_EXCL|os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
@@ -198,32 +474,82 @@ func (s *Starter) openPidFile() error {
 }
 
 func (s *Starter) openLogFile() error {
-	if s.LogFile == "" {
-		return nil
+	var err error
+	if s.logfile, err = s.openLogSink(s.LogFile); err != nil {
+		return err
 	}
-	if s.LogFile[0] == '|' {
-		ctx, cancel := context.WithCancel(context.Background())
-		cmd := exec.CommandContext(ctx, "sh", "-c", s.LogFile[1:])
-		stdin, err := cmd.StdinPipe()
+	stdout, err := s.openLogSink(s.StdoutLog)
+	if err != nil {
+		return err
+	}
+	stderr, err := s.openLogSink(s.StderrLog)
+	if err != nil {
+		return err
+	}
+	starter, err := s.openLogSink(s.StarterLog)
+	if err != nil {
+		return err
+	}
+
+	// the destinations fall back to LogFile.
+	s.stdoutLog = firstWriter(stdout, s.logfile)
+	s.stderrLog = firstWriter(stderr, s.logfile)
+	if w := firstWriter(starter, s.logfile); w != nil {
+		s.mylogger = log.New(w, "", 0)
+	}
+	return nil
+}
+
+// openLogSink opens the log file or starts the log command.
+// The sinks are shared if the same spec is specified.
+func (s *Starter) openLogSink(spec string) (io.WriteCloser, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if sink, ok := s.logSinks[spec]; ok {
+		return sink, nil
+	}
+
+	var sink io.WriteCloser
+	if strings.HasPrefix(spec, "syslog://") {
+		d, err := s.openSyslogSink(spec)
 		if err != nil {
-			cancel()
-			return nil
+			return nil, err
 		}
-		s.logfile = stdin
-		s.wg.Add(1)
-		go func() {
-			defer s.wg.Done()
-			defer cancel()
-			cmd.Run()
-		}()
+		sink = d
+	} else if strings.HasPrefix(spec, "journald://") {
+		d, err := s.openJournaldSink(spec)
+		if err != nil {
+			return nil, err
+		}
+		sink = d
+	} else if spec[0] == '|' {
+		p, err := newLogPipe(spec[1:], os.Stderr, logPipeBufferSize)
+		if err != nil {
+			return nil, err
+		}
+		sink = p
 	} else {
-		f, err := os.OpenFile(s.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		f, err := newLogFile(spec, int64(s.LogMaxSize), s.LogMaxAge, s.LogMaxBackups)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		sink = f
+	}
+
+	if s.logSinks == nil {
+		s.logSinks = make(map[string]io.WriteCloser)
+	}
+	s.logSinks[spec] = sink
+	return sink, nil
+}
+
+func firstWriter(writers ...io.WriteCloser) io.Writer {
+	for _, w := range writers {
+		if w != nil {
+			return w
 		}
-		s.logfile = f
 	}
-	s.mylogger = log.New(s.logfile, "", 0)
 	return nil
 }
 
@@ -235,16 +561,76 @@ func (s *Starter) waitSignal() {
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT,
+		syscall.SIGUSR1,
 	)
+	if len(s.ForwardSignals) > 0 {
+		signal.Notify(ch, s.ForwardSignals...)
+	}
+	if s.UpgradeSignal != nil {
+		signal.Notify(ch, s.UpgradeSignal)
+	}
 	for sig := range ch {
 		sig := sig
+		if sig == s.UpgradeSignal {
+			s.logf("received %s, upgrading start_server", signalToName(sig))
+			go s.upgrade()
+			continue
+		}
 		switch sig {
 		case syscall.SIGHUP:
 			s.logf("received HUP, spawning a new worker")
 			go s.Reload()
-		default:
+		case syscall.SIGUSR1:
+			if err := s.reopenLogFile(); err != nil {
+				s.logf("failed to reopen the log file: %s", err)
+			} else {
+				s.logf("received USR1, reopened the log file")
+			}
+		case syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
 			go s.shutdownBySignal(sig)
 		}
+		if s.isForwardSignal(sig) {
+			s.forwardSignal(sig)
+		}
+	}
+}
+
+func (s *Starter) isForwardSignal(sig os.Signal) bool {
+	for _, fs := range s.ForwardSignals {
+		if fs == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardSignal relays the signal to the server processes.
+func (s *Starter) forwardSignal(sig os.Signal) {
+	var workers []*worker
+	var target string
+	if s.ForwardSignalToAll {
+		workers = s.listWorkers()
+		target = "all workers"
+	} else if w := s.newestWorker(); w != nil {
+		workers = []*worker{w}
+		target = "the newest worker"
+	}
+	if len(workers) == 0 {
+		s.logf("received %s, no worker to forward it to", signalToName(sig))
+		return
+	}
+
+	var buf strings.Builder
+	for _, w := range workers {
+		if err := w.cmd.Process.Signal(sig); err != nil {
+			s.logf("failed to send signal %s to %d", signalToName(sig), w.Pid())
+			continue
+		}
+		buf.WriteByte(',')
+		buf.WriteString(strconv.Itoa(w.Pid()))
+	}
+	if buf.Len() > 0 {
+		s.logf("received %s, forwarded it to %s: %s", signalToName(sig), target, buf.String()[1:])
 	}
 }
 
@@ -289,6 +675,12 @@ type worker struct {
 	generation int
 	starter    *Starter
 	chsig      chan workerSignal
+
+	// the path of the heartbeat file, or empty if heartbeat is disabled.
+	heartbeatFile string
+
+	// the sockets that the worker inherits.
+	sockets []*listenSocket
 }
 
 type workerState int
@@ -321,10 +713,14 @@ RETRY:
 			return nil, errShutdown
 		}
 		s.logf("failed to exec %s:%s", s.Command, err)
+		if _, ok := err.(*execAttrError); ok {
+			// the attributes will never be applied, retrying is meaningless.
+			return nil, err
+		}
 		time.Sleep(s.interval())
 		goto RETRY
 	}
-	s.logf("starting new worker %d", w.Pid())
+	s.logf("starting new worker %d%s", w.Pid(), s.procAttrString())
 
 	var state *os.ProcessState
 	timer := time.NewTimer(s.interval())
@@ -361,47 +757,70 @@ func (s *Starter) tryToStartWorker() (*worker, error) {
 	defer func() {
 		<-ch
 	}()
-	addr := func(sock socket) string {
-		if addr, ok := sock.(interface{ Addr() net.Addr }); ok {
-			return addr.Addr().String()
-		}
-		if addr, ok := sock.(interface{ LocalAddr() net.Addr }); ok {
-			return addr.LocalAddr().String()
-		}
-		panic("fail to get addr")
-	}
 
-	sockets := s.getSockets()
+	sockets := s.acquireSockets()
 	files := make([]*os.File, len(sockets))
 	ports := make([]string, len(sockets))
-	for i, sock := range sockets {
-		f, err := sock.File()
+	for i, ls := range sockets {
+		f, err := ls.sock.File()
 		if err != nil {
+			closeFiles(files[:i])
+			s.releaseSockets(sockets)
 			return nil, err
 		}
 		files[i] = f
 
 		// file descriptor numbers in ExtraFiles turn out to be
 		// index + 3, so we can just hard code it
-		ports[i] = fmt.Sprintf("%s=%d", addr(sock), i+3)
+		ports[i] = fmt.Sprintf("%s=%d", ls.addr(), i+3)
+	}
+	var names []string
+	s.mu.RLock()
+	for i, ls := range sockets {
+		if ls.opt.name != "" {
+			names = append(names, fmt.Sprintf("%s=%d", ls.opt.name, i+3))
+		}
 	}
+	s.mu.RUnlock()
 
 	s.generation++
+	heartbeatFile, err := s.createHeartbeatFile(s.generation)
+	if err != nil {
+		closeFiles(files)
+		s.releaseSockets(sockets)
+		return nil, err
+	}
 	ctx, cancel := context.WithCancel(s.ctx)
 	cmd := exec.CommandContext(ctx, s.Command, s.Args...)
-	if s.logfile != nil {
-		cmd.Stdout = s.logfile
-		cmd.Stderr = s.logfile
-	} else {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	output, err := s.openWorkerOutput()
+	if err != nil {
+		cancel()
+		closeFiles(files)
+		s.releaseSockets(sockets)
+		return nil, err
 	}
+	defer output.closeWriters()
+	cmd.Stdout = output.stdout
+	cmd.Stderr = output.stderr
 	cmd.ExtraFiles = files
-	env := os.Environ()
-	env = append(env, fmt.Sprintf("%s=%s", PortEnvName, strings.Join(ports, ";")))
-	env = append(env, fmt.Sprintf("%s=%d", GenerationEnvName, s.generation))
-	env = append(env, loadEnv(s.EnvDir)...)
+	vars := []string{
+		fmt.Sprintf("%s=%s", PortEnvName, strings.Join(ports, ";")),
+		fmt.Sprintf("%s=%s", PortNamesEnvName, strings.Join(names, ";")),
+		fmt.Sprintf("%s=%d", GenerationEnvName, s.generation),
+	}
+	if heartbeatFile != "" {
+		vars = append(vars, fmt.Sprintf("%s=%s", HeartbeatEnvName, heartbeatFile))
+	}
+	env, err := s.buildEnv(vars)
+	if err != nil {
+		cancel()
+		closeFiles(files)
+		s.releaseSockets(sockets)
+		output.closeReaders()
+		return nil, err
+	}
 	cmd.Env = env
+	s.logEnvDiff(s.generation, env)
 	cmd.Dir = s.Dir
 	w := &worker{
 		ctx:        ctx,
@@ -411,11 +830,19 @@ func (s *Starter) tryToStartWorker() (*worker, error) {
 		generation: s.generation,
 		starter:    s,
 		chsig:      make(chan workerSignal),
+
+		heartbeatFile: heartbeatFile,
+		sockets:       sockets,
 	}
 
-	if err := w.cmd.Start(); err != nil {
+	if err := s.startCommand(w.cmd); err != nil {
+		cancel()
+		closeFiles(files)
+		s.releaseSockets(sockets)
+		output.closeReaders()
 		return nil, err
 	}
+	s.copyWorkerOutput(output, w)
 
 	s.addWorker(w)
 	w.Wait()
@@ -423,6 +850,12 @@ func (s *Starter) tryToStartWorker() (*worker, error) {
 	return w, nil
 }
 
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
 func (w *worker) Wait() {
 	w.starter.wg.Add(1)
 	go w.wait()
@@ -461,10 +894,13 @@ func (w *worker) watch() {
 				w.starter.wg.Add(1)
 				go func() {
 					defer s.wg.Done()
-					if !s.tryToLockReload() {
+					locked := s.tryToLockReload()
+					if !locked && !s.handoverPending.IsSet() {
 						return // restarting proccess is already started, skip
 					}
-					defer s.unlockReload()
+					if locked {
+						defer s.unlockReload()
+					}
 					w, err := s.startWorker()
 					if err != nil {
 						return
@@ -499,8 +935,10 @@ func (w *worker) Signal(sig os.Signal, state workerState) {
 }
 
 func (w *worker) close() error {
-	for _, f := range w.cmd.ExtraFiles {
-		f.Close()
+	closeFiles(w.cmd.ExtraFiles)
+	w.starter.releaseSockets(w.sockets)
+	if w.heartbeatFile != "" {
+		os.Remove(w.heartbeatFile)
 	}
 	w.cancel()
 	close(w.done)
@@ -508,116 +946,168 @@ func (w *worker) close() error {
 	return nil
 }
 
+// listen binds the sockets of --port and --path options.
+// If it is called again, it binds only the sockets that are newly added,
+// and retires the sockets that are removed.
 func (s *Starter) listen() error {
-	var errListen error
-	var sockets []socket
-	var lc net.ListenConfig
+	opts, err := s.listenOptions()
+	if err != nil {
+		return err
+	}
+	opts, err = expandListenOptions(s.ctx, opts)
+	if err != nil {
+		return err
+	}
 
-	for _, hostport := range s.Ports {
-		suffix := ""
-		if idx := strings.LastIndexByte(hostport, '='); idx >= 0 {
-			s.logf("%s: fd options are not supported", hostport)
-			if errListen == nil {
-				errListen = errors.New("fd options are not supported")
-			}
+	s.mu.RLock()
+	reloading := s.listenSockets != nil
+	current := make(map[string]*listenSocket, len(s.listenSockets))
+	for _, ls := range s.listenSockets {
+		current[ls.opt.key()] = ls
+	}
+	s.mu.RUnlock()
+
+	var errListen error
+	var added []*listenSocket
+	sockets := make([]*listenSocket, 0, len(opts))
+	names := make(map[*listenSocket]string)
+	for _, opt := range opts {
+		if ls, ok := current[opt.key()]; ok {
+			// keep the socket as is, except for its name.
+			delete(current, opt.key())
+			sockets = append(sockets, ls)
+			names[ls] = opt.name
 			continue
 		}
-		host, port, err := net.SplitHostPort(hostport)
+		ls, err := s.bind(opt)
 		if err != nil {
-			// try to parse the hostport as a port number
-			// by default, only bind to IPv4 (for compatibility)
-			host = "0.0.0.0"
-			port = hostport
-			suffix = "4"
-		}
-
-		var sock socket
-		var ok bool
-		if strings.HasPrefix(port, "u") {
-			// Listen UDP Port
-			port = strings.TrimPrefix(port, "u")
-			hostport = net.JoinHostPort(host, port)
-			conn, err := lc.ListenPacket(s.ctx, "udp"+suffix, hostport)
-			if err != nil {
-				s.logf("%s: failed to listen: %s", hostport, err)
-				if errListen == nil {
-					errListen = err
-				}
-				continue
-			}
-			sock, ok = conn.(socket)
-		} else {
-			// Listen TCP Port
-			hostport = net.JoinHostPort(host, port)
-			l, err := lc.Listen(s.ctx, "tcp"+suffix, hostport)
-			if err != nil {
-				s.logf("%s: failed to listen: %s", hostport, err)
-				if errListen == nil {
-					errListen = err
-				}
-				continue
-			}
-			sock, ok = l.(socket)
-		}
-		if !ok {
-			s.logf("%s: fail to get file description", hostport)
 			if errListen == nil {
-				errListen = errors.New("fail to get file description")
+				errListen = err
 			}
 			continue
 		}
-		sockets = append(sockets, sock)
+		sockets = append(sockets, ls)
+		added = append(added, ls)
 	}
 
-	for _, path := range s.Paths {
-		if stat, err := os.Lstat(path); err == nil && stat.Mode()&os.ModeSocket == os.ModeSocket {
-			s.logf("removing existing socket file: %s", path)
-			if err := os.Remove(path); err != nil {
-				s.logf("failed to remove existing socket file: %s: %s", path, err)
-				if errListen == nil {
-					errListen = err
-				}
-				continue
-			}
+	if errListen != nil {
+		for _, ls := range added {
+			s.closeSocket(ls)
 		}
-		_ = os.Remove(path)
-		l, err := lc.Listen(s.ctx, "unix", path)
+		return errListen
+	}
+
+	s.mu.Lock()
+	for ls, name := range names {
+		ls.opt.name = name
+	}
+	s.listenSockets = sockets
+	s.sockets = make([]socket, 0, len(sockets))
+	for _, ls := range sockets {
+		s.sockets = append(s.sockets, ls.sock)
+	}
+	var closing []*listenSocket
+	for _, ls := range current {
+		ls.retired = true
+		if ls.refs == 0 {
+			closing = append(closing, ls)
+		}
+	}
+	s.mu.Unlock()
+
+	if reloading {
+		for _, ls := range added {
+			s.logf("listening on %s", ls.opt)
+		}
+		for _, ls := range current {
+			s.logf("removing %s", ls.opt)
+		}
+	}
+	for _, ls := range closing {
+		s.logf("closing %s, no worker uses it", ls.opt)
+		s.closeSocket(ls)
+	}
+	return nil
+}
+
+// bind binds the socket of the option.
+func (s *Starter) bind(opt listenOption) (*listenSocket, error) {
+	ls := &listenSocket{opt: opt}
+	if opt.kind == "path" {
+		p, err := parseUnixPath(opt.value)
 		if err != nil {
-			s.logf("%s: failed to listen: %s", path, err)
-			if errListen == nil {
-				errListen = err
-			}
-			continue
+			return nil, err
 		}
-		if err := os.Chmod(path, 0777); err != nil {
-			s.logf("%s: failed to chmod: %s", path, err)
-			if errListen == nil {
-				errListen = err
-			}
-			continue
+		ls.unix = p
+	}
+
+	if sock := s.takeInheritedSocket(opt); sock != nil {
+		ls.sock = sock
+		ls.inherited = true
+	} else if ls.unix != nil {
+		sock, err := s.bindPath(ls.unix)
+		if err != nil {
+			return nil, err
 		}
-		socket, ok := l.(socket)
-		if !ok {
-			s.logf("%s: fail to get file description", path)
-			if errListen == nil {
-				errListen = errors.New("fail to get file description")
-			}
-			continue
+		ls.sock = sock
+	} else {
+		sock, err := s.bindPort(opt.value)
+		if err != nil {
+			return nil, err
 		}
-		sockets = append(sockets, socket)
+		ls.sock = sock
 	}
 
-	if errListen != nil {
-		for _, sock := range sockets {
-			sock.Close()
+	if ls.unix != nil && !ls.unix.abstract() {
+		// remember the socket file, not to remove the file that another socket is bound to.
+		ls.stat, _ = os.Lstat(ls.unix.path)
+	}
+	return ls, nil
+}
+
+func (s *Starter) bindPort(value string) (socket, error) {
+	p, err := parsePortOption(value)
+	if err != nil {
+		s.logf("%s: %s", value, err)
+		return nil, err
+	}
+	lc := net.ListenConfig{
+		Control: p.control,
+	}
+
+	var sock socket
+	var ok bool
+	if strings.HasPrefix(p.network, "udp") {
+		// Listen UDP Port
+		conn, err := lc.ListenPacket(s.ctx, p.network, p.address)
+		if err != nil {
+			s.logf("%s: failed to listen: %s", p.address, err)
+			return nil, err
 		}
-		return errListen
+		sock, ok = conn.(socket)
+	} else {
+		// Listen TCP Port
+		l, err := lc.Listen(s.ctx, p.network, p.address)
+		if err != nil {
+			s.logf("%s: failed to listen: %s", p.address, err)
+			return nil, err
+		}
+		sock, ok = l.(socket)
+	}
+	if !ok {
+		s.logf("%s: fail to get file description", p.address)
+		return nil, errors.New("fail to get file description")
 	}
+	return sock, nil
+}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.sockets = sockets
-	return nil
+func (s *Starter) bindPath(p *unixPath) (socket, error) {
+	sock, err := s.listenUnix(p)
+	if err != nil {
+		s.logf("%s: failed to listen: %s", p.path, err)
+		return nil, err
+	}
+	return sock, nil
 }
 
 // Listeners returns the listeners.
@@ -658,6 +1148,17 @@ func (s *Starter) Reload() error {
 		return nil
 	}
 	defer s.unlockReload()
+	return s.reload()
+}
+
+// reload starts a new worker and kills old workers.
+// the caller must hold the reload lock.
+func (s *Starter) reload() error {
+	if s.ListenFile != "" {
+		if err := s.listen(); err != nil {
+			s.logf("failed to update the sockets, keeping the current ones: %s", err)
+		}
+	}
 
 RETRY:
 	w, err := s.startWorker()
@@ -814,6 +1315,20 @@ func (s *Starter) listWorkers() []*worker {
 	return workers
 }
 
+// newestWorker returns the worker of the newest generation.
+// if no worker is running, it returns nil.
+func (s *Starter) newestWorker() *worker {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var newest *worker
+	for w := range s.workers {
+		if newest == nil || newest.generation < w.generation {
+			newest = w
+		}
+	}
+	return newest
+}
+
 func (s *Starter) addWorker(w *worker) {
 	s.mu.Lock()
 	if s.workers == nil {
@@ -833,7 +1348,7 @@ func (s *Starter) removeWorker(w *worker) {
 
 // updateStatus writes the workers' status into StatusFile.
 func (s *Starter) updateStatusLocked() {
-	if s.StatusFile == "" {
+	if s.StatusFile == "" || s.handedOver.IsSet() {
 		return // nothing to do
 	}
 	workers := make([]*worker, 0, len(s.workers))
@@ -936,26 +1451,53 @@ func (s *Starter) Close() error {
 }
 
 func (s *Starter) close() {
-	if s.logfile != nil {
-		s.logfile.Close()
-	}
 	if s.cancel != nil {
 		s.cancel()
 	}
-	for _, sock := range s.getSockets() {
-		sock.Close()
-		if l, ok := sock.(*net.UnixListener); ok {
-			os.Remove(l.Addr().String())
-		}
+	s.closeHandover()
+	if s.takeoverConn != nil {
+		s.takeoverConn.Close()
+	}
+	s.mu.RLock()
+	sockets := s.listenSockets
+	s.mu.RUnlock()
+	for _, ls := range sockets {
+		s.closeSocket(ls)
 	}
 	s.wg.Wait()
+
+	// the server processes have exited, flush their output and close the log destinations.
+	s.waitOutput(outputCloseTimeout)
+	s.closeAsyncWriters()
+	for _, sink := range s.logSinks {
+		sink.Close()
+	}
+	if s.heartbeatDir != "" {
+		os.RemoveAll(s.heartbeatDir)
+	}
+	s.closePidFile()
+}
+
+// closePidFile closes the pid file, and removes it unless the new start_server takes it over.
+func (s *Starter) closePidFile() {
 	if f := s.pidFile; f != nil {
-		os.Remove(f.Name())
+		if !s.keepPidFile && !s.pidFileInherited.IsSet() {
+			os.Remove(f.Name())
+		}
 		f.Close()
 	}
 }
 
 func (s *Starter) logf(format string, args ...interface{}) {
+	if s.LogFormat == "json" {
+		line := s.formatLine(time.Now(), 0, os.Getpid(), "start_server", []byte(fmt.Sprintf(format, args...)))
+		format, args = "%s", []interface{}{line}
+		if s.mylogger == nil && s.Logger == nil {
+			// the standard logger prefixes the date, which breaks the JSON lines.
+			os.Stderr.Write(line)
+			return
+		}
+	}
 	if s.mylogger != nil {
 		s.mylogger.Printf(format, args...)
 	} else if s.Logger != nil {
@@ -1066,3 +1608,22 @@ func (s *Starter) stop() error {
 	}
 	return nil
 }
+
+func (s *Starter) reopenLogs() error {
+	if s.PidFile == "" {
+		return errors.New("--reopen-logs option requires --pid-file to be set as well")
+	}
+	buf, err := ioutil.ReadFile(s.PidFile)
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(buf)))
+	if err != nil {
+		return err
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGUSR1)
+}
@@ -0,0 +1,294 @@
+package starter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_Rlimit(t *testing.T) {
+	before, err := ioutil.ReadFile("/proc/self/limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd := &Starter{
+		// Go runtime raises the soft limit of nofile by itself,
+		// so use the server program that isn't written in Go.
+		Command: "sleep",
+		Args:    []string{"60"},
+		Ports:   []string{"0"},
+		Rlimits: []Rlimit{
+			{Resource: "nofile", Cur: 512, Max: 1024},
+			{Resource: "core", Cur: 0, Max: 0},
+		},
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	time.Sleep(1500 * time.Millisecond) // wait for starting worker
+
+	w := sd.newestWorker()
+	if w == nil {
+		t.Fatal("no worker is running")
+	}
+	limits, err := ioutil.ReadFile("/proc/" + strconv.Itoa(w.Pid()) + "/limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := regexp.Match(`(?m)^Max open files\s+512\s+1024\s`, limits); !ok {
+		t.Errorf("want the nofile limit 512:1024, got %s", limits)
+	}
+	if ok, _ := regexp.Match(`(?m)^Max core file size\s+0\s+0\s`, limits); !ok {
+		t.Errorf("want the core limit 0:0, got %s", limits)
+	}
+
+	// the limits of start_server itself are not changed.
+	after, err := ioutil.ReadFile("/proc/self/limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("the limits of start_server are changed: want %s, got %s", before, after)
+	}
+}
+
+func Test_RlimitError(t *testing.T) {
+	sd := &Starter{
+		Command: "sleep",
+		Args:    []string{"60"},
+		Ports:   []string{"0"},
+		Rlimits: []Rlimit{
+			{Resource: "unknown", Cur: 0, Max: 0},
+		},
+	}
+	defer sd.Shutdown(context.Background())
+
+	// start_server doesn't retry to start the worker forever.
+	chErr := make(chan error, 1)
+	go func() {
+		chErr <- sd.Run()
+	}()
+	select {
+	case err := <-chErr:
+		if err == nil || !strings.Contains(err.Error(), "unknown resource") {
+			t.Errorf("want unknown resource error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timeout")
+	}
+}
+
+func Test_ProcAttr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build echod
+	binFile := filepath.Join(dir, "echod")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/echod/echod.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	nice := 5
+	adj := 500
+	umask := 027
+	sd := &Starter{
+		Command:     binFile,
+		Args:        []string{filepath.Join(dir, "signame")},
+		Ports:       []string{"0"},
+		Nice:        &nice,
+		OOMScoreAdj: &adj,
+		CPUAffinity: []int{0},
+		Umask:       &umask,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	time.Sleep(1500 * time.Millisecond) // wait for starting worker
+
+	w := sd.newestWorker()
+	if w == nil {
+		t.Fatal("no worker is running")
+	}
+	proc := "/proc/" + strconv.Itoa(w.Pid())
+	status, err := ioutil.ReadFile(proc + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := regexp.Match(`(?m)^Cpus_allowed_list:\s+0$`, status); !ok {
+		t.Errorf("want cpu affinity 0, got %s", status)
+	}
+	if ok, _ := regexp.Match(`(?m)^Umask:\s+0027$`, status); !ok {
+		t.Errorf("want umask 0027, got %s", status)
+	}
+
+	oom, err := ioutil.ReadFile(proc + "/oom_score_adj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(oom)) != "500" {
+		t.Errorf("want oom_score_adj 500, got %s", oom)
+	}
+
+	// the 19th field of /proc/[pid]/stat is the nice value.
+	stat, err := ioutil.ReadFile(proc + "/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+2:]))
+	if fields[16] != "5" {
+		t.Errorf("want nice 5, got %s", fields[16])
+	}
+
+	// the umask of start_server itself is never changed.
+	self := syscall.Umask(0)
+	syscall.Umask(self)
+	if self == umask {
+		t.Errorf("the umask of start_server is changed: %04o", self)
+	}
+}
+
+func Test_ProcAttrError(t *testing.T) {
+	sd := &Starter{
+		Command:     "sleep",
+		Args:        []string{"60"},
+		Ports:       []string{"0"},
+		CPUAffinity: []int{1023}, // no one has so many CPUs.
+	}
+	defer sd.Shutdown(context.Background())
+
+	// start_server doesn't retry to start the worker forever.
+	chErr := make(chan error, 1)
+	go func() {
+		chErr <- sd.Run()
+	}()
+	select {
+	case err := <-chErr:
+		if err == nil || !strings.Contains(err.Error(), "failed to set cpu affinity") {
+			t.Errorf("want cpu affinity error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timeout")
+	}
+}
+
+func Test_MaxRSS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that uses 64MB memory.
+	binFile := filepath.Join(dir, "bloat")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/bloat/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	sd := &Starter{
+		Command:      binFile,
+		Ports:        []string{"0"},
+		MaxRSS:       32 * 1024 * 1024,
+		MaxRSSPeriod: time.Second,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	// 0sec: start the first generation.
+	// 1sec: the first generation exceeds max-rss.
+	// 2sec: start the second generation.
+	// 3sec: the second generation is running.
+	time.Sleep(4 * time.Second)
+
+	w := sd.newestWorker()
+	if w == nil {
+		t.Fatal("no worker is running")
+	}
+	if w.generation < 2 {
+		t.Errorf("want the generation is 2 or more, got %d", w.generation)
+	}
+}
+
+func Test_UnixAbstract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build echod
+	binFile := filepath.Join(dir, "unix")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/unix/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	name := fmt.Sprintf("@server-starter-test-%d.sock", os.Getpid())
+	sd := &Starter{
+		Command: binFile,
+		Paths:   []string{name},
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	time.Sleep(500 * time.Millisecond) // wait for starting worker
+
+	conn, err := net.Dial("unix", name)
+	if err != nil {
+		t.Fatalf("fail to dial: %s", err)
+	}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Errorf("fail to write: %s", err)
+	}
+	var buf [1024]byte
+	n, err := conn.Read(buf[:])
+	if err != nil {
+		t.Errorf("fail to read: %s", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Errorf("want hello, got %s", buf[:n])
+	}
+	conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sd.Shutdown(ctx)
+
+	// the name is released.
+	if conn, err := net.Dial("unix", name); err == nil {
+		conn.Close()
+		t.Errorf("want %s is closed, but it is still listening", name)
+	}
+}
@@ -3,12 +3,15 @@ package starter
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -356,6 +359,276 @@ func Test_Unix(t *testing.T) {
 	}
 }
 
+func Test_PortRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies SERVER_STARTER_PORT.
+	binFile := filepath.Join(dir, "ports")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/ports/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	// find two consecutive free ports.
+	var port int
+	for i := 0; i < 100 && port == 0; i++ {
+		l1, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := l1.Addr().(*net.TCPAddr).Port
+		l2, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(p+1))
+		if err == nil {
+			l2.Close()
+			port = p
+		}
+		l1.Close()
+	}
+	if port == 0 {
+		t.Skip("no consecutive free ports")
+	}
+
+	sd := &Starter{
+		Command: binFile,
+		Ports:   []string{fmt.Sprintf("127.0.0.1:%d-%d", port, port+1)},
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	time.Sleep(2 * time.Second)
+	if n := len(sd.Listeners()); n != 2 {
+		t.Fatalf("want 2 listeners, got %d", n)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("fail to dial: %s", err)
+	}
+	defer conn.Close()
+	var buf [1024]byte
+	n, err := conn.Read(buf[:])
+	if err != nil {
+		t.Fatalf("fail to read: %s", err)
+	}
+	want := fmt.Sprintf("127.0.0.1:%d=3;127.0.0.1:%d=4", port, port+1)
+	if ports := string(buf[:n]); ports != want {
+		t.Errorf("want %s, got %s", want, ports)
+	}
+}
+
+func Test_NamedSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies the names of the sockets.
+	binFile := filepath.Join(dir, "named")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/named/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	listenFile := filepath.Join(dir, "listen")
+	sockFile := filepath.Join(dir, "admin.sock")
+	if err := ioutil.WriteFile(listenFile, []byte("--path=admin@"+sockFile+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sd := &Starter{
+		Command:    binFile,
+		Ports:      []string{"web@127.0.0.1:0"},
+		ListenFile: listenFile,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	getName := func(network, addr string) string {
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	time.Sleep(2 * time.Second)
+	addr := sd.Listeners()[0].Addr().String()
+	if name := getName("tcp", addr); name != "web" {
+		t.Errorf("want web, got %s", name)
+	}
+	if name := getName("unix", sockFile); name != "admin" {
+		t.Errorf("want admin, got %s", name)
+	}
+	stat1, err := os.Lstat(sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rename the socket, it is not bound again.
+	if err := ioutil.WriteFile(listenFile, []byte("--path=ops@"+sockFile+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	go sd.Reload()
+	time.Sleep(4 * time.Second)
+	if name := getName("unix", sockFile); name != "ops" {
+		t.Errorf("want ops, got %s", name)
+	}
+	stat2, err := os.Lstat(sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(stat1, stat2) {
+		t.Errorf("want %s is kept, but it is bound again", sockFile)
+	}
+}
+
+func Test_UnixMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies SERVER_STARTER_PORT.
+	binFile := filepath.Join(dir, "ports")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/ports/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	sockFile := filepath.Join(dir, "sock")
+	sd := &Starter{
+		Command: binFile,
+		Ports:   []string{"127.0.0.1:0"},
+		Paths:   []string{sockFile + "?mode=0600&owner=" + strconv.Itoa(os.Getuid())},
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	time.Sleep(2 * time.Second)
+
+	stat, err := os.Lstat(sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode()&os.ModeSocket == 0 {
+		t.Errorf("want %s is a socket, got %s", sockFile, stat.Mode())
+	}
+	if perm := stat.Mode().Perm(); perm != 0600 {
+		t.Errorf("want mode 0600, got %#o", perm)
+	}
+
+	// the server processes see the path, not the temporary one.
+	addr := sd.Listeners()[0].Addr().String()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("fail to dial: %s", err)
+	}
+	defer conn.Close()
+	var buf [1024]byte
+	n, err := conn.Read(buf[:])
+	if err != nil {
+		t.Fatalf("fail to read: %s", err)
+	}
+	if ports, want := string(buf[:n]), addr+"=3;"+sockFile+"=4"; ports != want {
+		t.Errorf("want %s, got %s", want, ports)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sd.Shutdown(ctx)
+
+	if _, err := os.Lstat(sockFile); err == nil {
+		t.Errorf("want %s is removed, but exists", sockFile)
+	}
+}
+
+func Test_Unixgram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies its pid.
+	binFile := filepath.Join(dir, "unixgram")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/unixgram/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	sockFile := filepath.Join(dir, "sock")
+	sd := &Starter{
+		Command: binFile,
+		Paths:   []string{"unixgram:" + sockFile},
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	client, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "client"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	getPid := func() string {
+		if _, err := client.WriteTo([]byte("hello"), &net.UnixAddr{Name: sockFile, Net: "unixgram"}); err != nil {
+			t.Fatalf("fail to write: %s", err)
+		}
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var buf [1024]byte
+		n, err := client.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	time.Sleep(2 * time.Second) // wait for starting worker
+	pid1 := getPid()
+
+	// the new worker inherits the socket.
+	go sd.Reload()
+	time.Sleep(4 * time.Second)
+	pid2 := getPid()
+	if pid1 == pid2 {
+		t.Errorf("want the new worker replies, got the old one %s", pid1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sd.Shutdown(ctx)
+
+	if _, err := os.Lstat(sockFile); err == nil {
+		t.Errorf("want %s is removed, but exists", sockFile)
+	}
+}
+
 func Test_Dir(t *testing.T) {
 	dir, err := ioutil.TempDir("", "server-starter-test")
 	if err != nil {
@@ -521,6 +794,30 @@ func Test_AutoRestart(t *testing.T) {
 	}
 }
 
+func Test_BrokenEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, ".env")
+	if err := ioutil.WriteFile(envFile, []byte("FOO=\"unterminated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// start_server refuses to start without the values in the env file.
+	sd := &Starter{
+		Command:  "sleep",
+		Args:     []string{"60"},
+		Ports:    []string{"0"},
+		EnvFiles: []string{envFile},
+	}
+	if err := sd.Run(); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
 func Test_EnvDir(t *testing.T) {
 	dir, err := ioutil.TempDir("", "server-starter-test")
 	if err != nil {
@@ -585,8 +882,9 @@ func Test_EnvDir(t *testing.T) {
 	}
 
 	// ... but the worker returns the old environment value before reload.
+	// trailing spaces are removed in the same manner as envdir of daemontools.
 	v := getEnv()
-	if v != "FOO= old env " {
+	if v != "FOO= old env" {
 		t.Errorf("want FOO= old env, got %s", v)
 	}
 
@@ -609,3 +907,885 @@ func Test_EnvDir(t *testing.T) {
 		t.Errorf("want not found!, got %s", v)
 	}
 }
+
+func Test_Heartbeat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that hangs up in the first generation.
+	binFile := filepath.Join(dir, "heartbeat")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/heartbeat/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	sd := &Starter{
+		Command:           binFile,
+		Ports:             []string{"0"},
+		HeartbeatInterval: 500 * time.Millisecond,
+		HeartbeatMisses:   2,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	getGeneration := func() string {
+		addr := sd.Listeners()[0].Addr().String()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	// 0sec: start the first generation, it never touches the heartbeat file.
+	// 1sec: the first generation misses 2 heartbeats, start the second generation.
+	// 2sec: the second generation is running, and the first generation is killed.
+	time.Sleep(4 * time.Second)
+	if generation := getGeneration(); generation != "2" {
+		t.Errorf("want %s, got %s", "2", generation)
+	}
+
+	// the second generation keeps alive.
+	time.Sleep(2 * time.Second)
+	if generation := getGeneration(); generation != "2" {
+		t.Errorf("want %s, got %s", "2", generation)
+	}
+}
+
+func Test_DevWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build server
+	binFile := filepath.Join(dir, "generation")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/generation/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	// the build succeeds if and only if the source directory contains "ok".
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "ok"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sd := &Starter{
+		Command:    binFile,
+		Ports:      []string{"0"},
+		DevWatch:   []string{src + "/..."},
+		Build:      "test -f ok",
+		Dir:        src,
+		WatchDelay: 200 * time.Millisecond,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	getGeneration := func() string {
+		addr := sd.Listeners()[0].Addr().String()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	time.Sleep(1500 * time.Millisecond) // wait for starting worker
+	if generation := getGeneration(); generation != "1" {
+		t.Errorf("want %s, got %s", "1", generation)
+	}
+
+	// the build fails, and the first generation keeps serving.
+	if err := os.Remove(filepath.Join(src, "ok")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+	if generation := getGeneration(); generation != "1" {
+		t.Errorf("want %s, got %s", "1", generation)
+	}
+
+	// the build succeeds, and a new worker is spawned.
+	if err := ioutil.WriteFile(filepath.Join(src, "ok"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+	if generation := getGeneration(); generation != "2" {
+		t.Errorf("want %s, got %s", "2", generation)
+	}
+}
+
+func Test_WatchDuringReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build server
+	binFile := filepath.Join(dir, "generation")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/generation/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+	watchFile := filepath.Join(dir, "watch")
+	if err := ioutil.WriteFile(watchFile, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sd := &Starter{
+		Command:    binFile,
+		Ports:      []string{"0"},
+		Watch:      []string{watchFile},
+		WatchDelay: 200 * time.Millisecond,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	getGeneration := func() string {
+		addr := sd.Listeners()[0].Addr().String()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	time.Sleep(1500 * time.Millisecond) // wait for starting worker
+	if generation := getGeneration(); generation != "1" {
+		t.Errorf("want %s, got %s", "1", generation)
+	}
+
+	// the file is changed while another reload is running.
+	sd.lockReload()
+	if err := ioutil.WriteFile(watchFile, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	if generation := getGeneration(); generation != "1" {
+		t.Errorf("want %s, got %s", "1", generation)
+	}
+
+	// the change is picked up after the running reload.
+	sd.unlockReload()
+	time.Sleep(2 * time.Second)
+	if generation := getGeneration(); generation != "2" {
+		t.Errorf("want %s, got %s", "2", generation)
+	}
+}
+
+func Test_WatchEnvDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// set up envdir
+	envdir := filepath.Join(dir, "envdir")
+	if err := os.Mkdir(envdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv("FOO")
+	envfile := filepath.Join(envdir, "FOO")
+	if err := ioutil.WriteFile(envfile, []byte("old env\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// build server
+	binFile := filepath.Join(dir, "env")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/env/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	sd := &Starter{
+		Command:     binFile,
+		Ports:       []string{"0"},
+		EnvDir:      envdir,
+		WatchEnvDir: true,
+		WatchDelay:  200 * time.Millisecond,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	getEnv := func() string {
+		// connect to the worker.
+		addr := sd.Listeners()[0].Addr().String()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			t.Fatalf("fail to write: %s", err)
+		}
+		var buf [1024 * 1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	time.Sleep(1500 * time.Millisecond) // wait for starting worker
+	if v := getEnv(); v != "FOO=old env" {
+		t.Errorf("want FOO=old env, got %s", v)
+	}
+
+	// rewrite envdir, and the worker is reloaded automatically.
+	if err := ioutil.WriteFile(envfile, []byte("new env\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+	if v := getEnv(); v != "FOO=new env" {
+		t.Errorf("want FOO=new env, got %s", v)
+	}
+}
+
+func Test_ForwardSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that counts USR2 signals.
+	binFile := filepath.Join(dir, "signal")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/signal/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	sd := &Starter{
+		Command:        binFile,
+		Ports:          []string{"0"},
+		ForwardSignals: []os.Signal{syscall.SIGUSR2},
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	getCount := func() string {
+		addr := sd.Listeners()[0].Addr().String()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	time.Sleep(2 * time.Second)
+	sd.forwardSignal(syscall.SIGUSR2)
+	time.Sleep(500 * time.Millisecond)
+	sd.forwardSignal(syscall.SIGUSR2)
+	time.Sleep(500 * time.Millisecond)
+	if count := getCount(); count != "1:2" {
+		t.Errorf("want %s, got %s", "1:2", count)
+	}
+
+	// the signal is relayed to the new generation.
+	if err := sd.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	sd.forwardSignal(syscall.SIGUSR2)
+	time.Sleep(500 * time.Millisecond)
+	if count := getCount(); count != "2:1" {
+		t.Errorf("want %s, got %s", "2:1", count)
+	}
+}
+
+func Test_ListenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies SERVER_STARTER_PORT.
+	binFile := filepath.Join(dir, "ports")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/ports/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	listenFile := filepath.Join(dir, "listen")
+	sockA := filepath.Join(dir, "a.sock")
+	sockB := filepath.Join(dir, "b.sock")
+	if err := ioutil.WriteFile(listenFile, []byte("# sockets\n--path="+sockA+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sd := &Starter{
+		Command:    binFile,
+		Ports:      []string{"127.0.0.1:0"},
+		ListenFile: listenFile,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+
+	getPorts := func(addr string) string {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	time.Sleep(2 * time.Second)
+	addr := sd.Listeners()[0].Addr().String()
+	if ports, want := getPorts(addr), addr+"=3;"+sockA+"=4"; ports != want {
+		t.Errorf("want %s, got %s", want, ports)
+	}
+
+	// replace a.sock with b.sock.
+	if err := ioutil.WriteFile(listenFile, []byte("--path="+sockB+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	// the tcp socket is kept as is.
+	if got := sd.Listeners()[0].Addr().String(); got != addr {
+		t.Errorf("want %s, got %s", addr, got)
+	}
+	if ports, want := getPorts(addr), addr+"=3;"+sockB+"=4"; ports != want {
+		t.Errorf("want %s, got %s", want, ports)
+	}
+	if _, err := os.Stat(sockA); !os.IsNotExist(err) {
+		t.Errorf("want %s to be removed, got %v", sockA, err)
+	}
+	if _, err := os.Stat(sockB); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Upgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build start_server and server
+	starterFile := filepath.Join(dir, "start_server")
+	cmd := exec.Command("go", "build", "-o", starterFile, "./cmd/start_server")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+	binFile := filepath.Join(dir, "generation")
+	cmd = exec.Command("go", "build", "-o", binFile, "testdata/generation/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	sockFile := filepath.Join(dir, "app.sock")
+	pidFile := filepath.Join(dir, "start_server.pid")
+	cmd = exec.Command(
+		starterFile,
+		"--path="+sockFile,
+		"--pid-file="+pidFile,
+		"--upgrade-signal=USR2",
+		"--", binFile,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	defer cmd.Process.Kill()
+
+	getGeneration := func() string {
+		conn, err := net.Dial("unix", sockFile)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+	readPid := func() int {
+		buf, err := ioutil.ReadFile(pidFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pid
+	}
+
+	time.Sleep(2 * time.Second)
+	if generation := getGeneration(); generation != "1" {
+		t.Errorf("want %s, got %s", "1", generation)
+	}
+
+	// upgrade start_server.
+	if err := cmd.Process.Signal(syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the old start_server doesn't exit")
+	}
+
+	// the new start_server takes over the socket and the pid file.
+	pid := readPid()
+	if pid == cmd.Process.Pid {
+		t.Errorf("want the pid of the new start_server, got %d", pid)
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		// stop the new start_server.
+		p.Signal(syscall.SIGTERM)
+		for i := 0; i < 50; i++ {
+			if err := p.Signal(syscall.Signal(0)); err != nil {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		p.Kill()
+	}()
+	if generation := getGeneration(); generation != "2" {
+		t.Errorf("want %s, got %s", "2", generation)
+	}
+}
+
+func Test_UpgradeFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build start_server and server
+	starterFile := filepath.Join(dir, "start_server")
+	cmd := exec.Command("go", "build", "-o", starterFile, "./cmd/start_server")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+	binFile := filepath.Join(dir, "generation")
+	cmd = exec.Command("go", "build", "-o", binFile, "testdata/generation/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+
+	sockFile := filepath.Join(dir, "app.sock")
+	pidFile := filepath.Join(dir, "start_server.pid")
+	listenFile := filepath.Join(dir, "listen")
+	if err := ioutil.WriteFile(listenFile, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command(
+		starterFile,
+		"--path="+sockFile,
+		"--pid-file="+pidFile,
+		"--listen-file="+listenFile,
+		"--upgrade-signal=USR2",
+		"--", binFile,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Signal(syscall.SIGTERM)
+		cmd.Wait()
+	}()
+
+	getGeneration := func() string {
+		conn, err := net.Dial("unix", sockFile)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	time.Sleep(2 * time.Second)
+	if generation := getGeneration(); generation != "1" {
+		t.Errorf("want %s, got %s", "1", generation)
+	}
+
+	// the new start_server fails to bind the port in use.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := ioutil.WriteFile(listenFile, []byte("--port="+l.Addr().String()+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Process.Signal(syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+
+	// the old start_server keeps running with its socket file and pid file.
+	if generation := getGeneration(); generation != "1" {
+		t.Errorf("want %s, got %s", "1", generation)
+	}
+	buf, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%d\n", cmd.Process.Pid); string(buf) != want {
+		t.Errorf("want %q, got %q", want, buf)
+	}
+}
+
+func Test_Takeover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies the environment value FOO.
+	binFile := filepath.Join(dir, "env")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/env/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+	handoverSocket := filepath.Join(dir, "handover.sock")
+
+	getEnv := func(addr string) string {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("fail to dial: %s", err)
+		}
+		defer conn.Close()
+		var buf [1024]byte
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			t.Fatalf("fail to read: %s", err)
+		}
+		return string(buf[:n])
+	}
+
+	// start the old start_server.
+	sdOld := &Starter{
+		Command:        binFile,
+		Ports:          []string{"127.0.0.1:0"},
+		Env:            []string{"FOO=old"},
+		HandoverSocket: handoverSocket,
+	}
+	defer sdOld.Shutdown(context.Background())
+	oldExited := make(chan struct{})
+	go func() {
+		defer close(oldExited)
+		if err := sdOld.Run(); err != nil {
+			t.Errorf("sdOld.Run() failed: %s", err)
+		}
+	}()
+	time.Sleep(2 * time.Second)
+	addr := sdOld.Listeners()[0].Addr().String()
+	if env := getEnv(addr); env != "FOO=old" {
+		t.Errorf("want %s, got %s", "FOO=old", env)
+	}
+
+	// the new start_server takes over the socket.
+	sdNew := &Starter{
+		Command:        binFile,
+		Ports:          []string{"127.0.0.1:0"},
+		Env:            []string{"FOO=new"},
+		HandoverSocket: handoverSocket,
+		Takeover:       handoverSocket,
+	}
+	defer sdNew.Shutdown(context.Background())
+	go func() {
+		if err := sdNew.Run(); err != nil {
+			t.Errorf("sdNew.Run() failed: %s", err)
+		}
+	}()
+
+	select {
+	case <-oldExited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the old start_server doesn't exit")
+	}
+	if got := sdNew.Listeners()[0].Addr().String(); got != addr {
+		t.Errorf("want %s, got %s", addr, got)
+	}
+	if env := getEnv(addr); env != "FOO=new" {
+		t.Errorf("want %s, got %s", "FOO=new", env)
+	}
+
+	// the new start_server accepts the next takeover.
+	time.Sleep(500 * time.Millisecond)
+	if stat, err := os.Stat(handoverSocket); err != nil {
+		t.Error(err)
+	} else if perm := stat.Mode().Perm(); perm != 0600 {
+		t.Errorf("want 0600, got %04o", perm)
+	}
+}
+
+func Test_TakeoverFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies the environment value FOO.
+	binFile := filepath.Join(dir, "env")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/env/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+	handoverSocket := filepath.Join(dir, "handover.sock")
+	sockFile := filepath.Join(dir, "app.sock")
+
+	sdOld := &Starter{
+		Command:        binFile,
+		Paths:          []string{sockFile},
+		HandoverSocket: handoverSocket,
+	}
+	defer sdOld.Shutdown(context.Background())
+	go func() {
+		if err := sdOld.Run(); err != nil {
+			t.Errorf("sdOld.Run() failed: %s", err)
+		}
+	}()
+	time.Sleep(2 * time.Second)
+
+	// the new start_server takes the sockets, and fails to bind the port in use.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	sdNew := &Starter{
+		Command:  binFile,
+		Paths:    []string{sockFile},
+		Ports:    []string{l.Addr().String()},
+		Takeover: handoverSocket,
+	}
+	if err := sdNew.Run(); err == nil {
+		t.Error("want error, got nil")
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	// the old start_server keeps serving on its socket file.
+	conn, err := net.Dial("unix", sockFile)
+	if err != nil {
+		t.Fatalf("fail to dial: %s", err)
+	}
+	conn.Close()
+	if sdOld.handoverPending.IsSet() || sdOld.handedOver.IsSet() {
+		t.Error("the old start_server is handing over the sockets")
+	}
+}
+
+func Test_TakeoverPidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies the environment value FOO.
+	binFile := filepath.Join(dir, "env")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/env/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+	handoverSocket := filepath.Join(dir, "handover.sock")
+	pidFile := filepath.Join(dir, "pid")
+
+	sdOld := &Starter{
+		Command:        binFile,
+		Ports:          []string{"127.0.0.1:0"},
+		HandoverSocket: handoverSocket,
+		PidFile:        pidFile,
+	}
+	defer sdOld.Shutdown(context.Background())
+	go func() {
+		if err := sdOld.Run(); err != nil {
+			t.Errorf("sdOld.Run() failed: %s", err)
+		}
+	}()
+	time.Sleep(2 * time.Second)
+
+	// the new start_server can't open the pid file, and gives up before taking the sockets.
+	sdNew := &Starter{
+		Command:  binFile,
+		Ports:    []string{"127.0.0.1:0"},
+		Takeover: handoverSocket,
+		PidFile:  pidFile,
+	}
+	chErr := make(chan error, 1)
+	go func() {
+		chErr <- sdNew.Run()
+	}()
+	select {
+	case err := <-chErr:
+		if err == nil {
+			t.Error("want error, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the new start_server doesn't exit")
+	}
+	if sdOld.handoverPending.IsSet() || sdOld.handedOver.IsSet() {
+		t.Error("the old start_server is handing over the sockets")
+	}
+	buf, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%d\n", os.Getpid()); string(buf) != want {
+		t.Errorf("want %q, got %q", want, buf)
+	}
+}
+
+func Test_RestartDuringHandover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// build a server that replies the environment value FOO.
+	binFile := filepath.Join(dir, "env")
+	cmd := exec.Command("go", "build", "-o", binFile, "testdata/env/main.go")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %s\n%s", dir, err, output)
+	}
+	handoverSocket := filepath.Join(dir, "handover.sock")
+
+	sd := &Starter{
+		Command:        binFile,
+		Ports:          []string{"127.0.0.1:0"},
+		HandoverSocket: handoverSocket,
+	}
+	defer sd.Shutdown(context.Background())
+	go func() {
+		if err := sd.Run(); err != nil {
+			t.Errorf("sd.Run() failed: %s", err)
+		}
+	}()
+	time.Sleep(2 * time.Second)
+
+	// a new start_server takes the sockets, but doesn't get ready.
+	sdNew := &Starter{
+		Takeover: handoverSocket,
+	}
+	if err := sdNew.takeover(); err != nil {
+		t.Fatal(err)
+	}
+	if sdNew.takeoverConn == nil {
+		t.Fatal("want the sockets are taken, but not")
+	}
+	defer func() {
+		for _, sock := range sdNew.inheritedSockets {
+			sock.Close()
+		}
+	}()
+	time.Sleep(500 * time.Millisecond)
+	if !sd.handoverPending.IsSet() {
+		t.Fatal("want the handover is pending, but not")
+	}
+
+	// the worker that dies unexpectedly is restarted while the handover is pending.
+	old := sd.newestWorker()
+	old.cmd.Process.Kill()
+	time.Sleep(2 * time.Second)
+	if w := sd.newestWorker(); w == nil || w == old {
+		t.Error("want a new worker, but not restarted")
+	}
+
+	// the new start_server gives up, and reloading is enabled again.
+	sdNew.takeoverConn.Close()
+	time.Sleep(500 * time.Millisecond)
+	if sd.handoverPending.IsSet() {
+		t.Error("want the handover is aborted, but pending")
+	}
+	if !sd.tryToLockReload() {
+		t.Error("want reloading is enabled, but locked")
+	} else {
+		sd.unlockReload()
+	}
+}
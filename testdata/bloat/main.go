@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/shogo82148/server-starter/listener"
+)
+
+// memory is allocated memory, which is never released.
+var memory []byte
+
+func main() {
+	go watchSignal()
+
+	// emulate memory leak
+	memory = make([]byte, 64*1024*1024)
+	for i := range memory {
+		memory[i] = byte(i)
+	}
+
+	ll, err := listener.Ports()
+	if err != nil {
+		log.Fatal(err)
+	}
+	l, err := ll.ListenAll(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for {
+		conn, err := l[0].Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go handle(conn)
+	}
+}
+
+func handle(conn net.Conn) {
+	conn.Write([]byte(os.Getenv("SERVER_STARTER_GENERATION")))
+	conn.Close()
+}
+
+func watchSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM)
+	<-c
+	os.Exit(0)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/shogo82148/server-starter/listener"
+)
+
+func main() {
+	go watchSignal()
+
+	ll, err := listener.Ports()
+	if err != nil {
+		log.Fatal(err)
+	}
+	l, err := ll.ListenAll(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for {
+		conn, err := l[0].Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go handle(conn)
+	}
+}
+
+func handle(conn net.Conn) {
+	conn.Write([]byte(os.Getenv("SERVER_STARTER_GENERATION")))
+	conn.Close()
+}
+
+func watchSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM)
+	<-c
+	os.Exit(0)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/shogo82148/server-starter/listener"
+)
+
+func main() {
+	go watchSignal()
+
+	ll, err := listener.Ports()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, spec := range ll {
+		l, err := spec.Listen()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go serve(l, spec.Name())
+	}
+	select {}
+}
+
+// serve replies the name of the socket.
+func serve(l net.Listener, name string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		conn.Write([]byte(name))
+		conn.Close()
+	}
+}
+
+func watchSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM)
+	<-c
+	os.Exit(0)
+}
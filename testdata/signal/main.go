@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/shogo82148/server-starter/listener"
+)
+
+// the number of received USR2 signals.
+var count int64
+
+func main() {
+	go watchSignal()
+
+	ll, err := listener.Ports()
+	if err != nil {
+		log.Fatal(err)
+	}
+	l, err := ll.ListenAll(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for {
+		conn, err := l[0].Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go handle(conn)
+	}
+}
+
+func handle(conn net.Conn) {
+	fmt.Fprintf(conn, "%s:%d", os.Getenv("SERVER_STARTER_GENERATION"), atomic.LoadInt64(&count))
+	conn.Close()
+}
+
+func watchSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGUSR2)
+	for sig := range c {
+		if sig == syscall.SIGTERM {
+			os.Exit(0)
+		}
+		atomic.AddInt64(&count, 1)
+	}
+}
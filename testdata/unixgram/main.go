@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/shogo82148/server-starter/listener"
+)
+
+func main() {
+	ll, err := listener.Ports()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(ll) == 0 {
+		log.Fatal("no socket")
+	}
+	conn, err := ll.ListenPacket(context.Background(), "unixgram", ll[0].Addr())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// reply the pid, to distinguish the generations.
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	var buf [1024]byte
+	for {
+		_, addr, err := conn.ReadFrom(buf[:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := conn.WriteTo(pid, addr); err != nil {
+			log.Printf("write error: %s", err)
+		}
+	}
+}
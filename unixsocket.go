@@ -0,0 +1,222 @@
+package starter
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// unixPath is a parsed --path option, e.g. "/run/app.sock?mode=0660&owner=app&group=www".
+// The query starts at the last '?', so the path that contains '?' needs a trailing '?', e.g. "/run/app?.sock?".
+// The path that starts with '@' is an abstract unix socket on Linux, e.g. "@app.sock".
+// The network can be prefixed to the path, e.g. "unixgram:/run/log.sock".
+type unixPath struct {
+	// "unix", "unixgram" or "unixpacket"
+	network string
+
+	path string
+
+	// the permission of the socket file.
+	mode os.FileMode
+
+	// the owner and the group of the socket file, -1 means unchanged.
+	uid int
+	gid int
+
+	// explicit is true if the query sets the permission or the owner.
+	explicit bool
+}
+
+func parseUnixPath(value string) (*unixPath, error) {
+	p := &unixPath{
+		network: "unix",
+		path:    value,
+		mode:    0777,
+		uid:     -1,
+		gid:     -1,
+	}
+	for _, network := range []string{"unix", "unixgram", "unixpacket"} {
+		if strings.HasPrefix(p.path, network+":") {
+			p.network = network
+			p.path = p.path[len(network)+1:]
+			break
+		}
+	}
+
+	var query url.Values
+	if idx := strings.LastIndexByte(p.path, '?'); idx >= 0 {
+		var err error
+		query, err = url.ParseQuery(p.path[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", value, err)
+		}
+		p.path = p.path[:idx]
+	}
+	for key, values := range query {
+		v := values[len(values)-1]
+		switch key {
+		case "mode":
+			mode, err := strconv.ParseUint(v, 8, 32)
+			if err != nil || mode > 0777 {
+				return nil, fmt.Errorf("%s: invalid mode: %s", value, v)
+			}
+			p.mode = os.FileMode(mode)
+		case "owner":
+			uid, err := lookupUser(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", value, err)
+			}
+			p.uid = uid
+		case "group":
+			gid, err := lookupGroup(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", value, err)
+			}
+			p.gid = gid
+		default:
+			return nil, fmt.Errorf("%s: unknown option: %s", value, key)
+		}
+	}
+	p.explicit = len(query) > 0
+	if p.path == "" {
+		return nil, fmt.Errorf("%s: empty path", value)
+	}
+	if p.abstract() {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("%s: abstract unix sockets are supported only on Linux", value)
+		}
+		if len(query) > 0 {
+			// the abstract sockets have no file, so no permission.
+			return nil, fmt.Errorf("%s: mode, owner and group are not supported by abstract unix sockets", value)
+		}
+	}
+	return p, nil
+}
+
+// abstract returns whether the socket is in the abstract namespace.
+func (p *unixPath) abstract() bool {
+	return strings.HasPrefix(p.path, "@")
+}
+
+// lookupUser returns the user id of the user name or the user id.
+func lookupUser(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGroup returns the group id of the group name or the group id.
+func lookupGroup(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// listen binds the socket at the name.
+func (p *unixPath) listen(name string) (socket, error) {
+	addr := &net.UnixAddr{Name: name, Net: p.network}
+	if p.network == "unixgram" {
+		return net.ListenUnixgram(p.network, addr)
+	}
+	l, err := net.ListenUnix(p.network, addr)
+	if err != nil {
+		return nil, err
+	}
+	// the socket file is removed by start_server, see closeSocket.
+	l.SetUnlinkOnClose(false)
+	return l, nil
+}
+
+// maxUnixPathLen is the maximum length of the path of unix sockets, excluding the terminating NUL.
+var maxUnixPathLen = len(syscall.RawSockaddrUnix{}.Path) - 1
+
+// listenUnix binds the unix socket under a temporary name, sets its permission and owner,
+// and then renames it into place. So there is never a window with wrong permissions.
+func (s *Starter) listenUnix(p *unixPath) (socket, error) {
+	if p.abstract() {
+		// the name is released when the socket is closed, no file to care about.
+		return p.listen(p.path)
+	}
+
+	// the temporary name is short, so the paths close to the limit of sun_path can be bound.
+	tmp := filepath.Join(filepath.Dir(p.path), fmt.Sprintf(".%d.sock", os.Getpid()))
+	if len(tmp) > maxUnixPathLen && len(p.path) <= maxUnixPathLen {
+		// the temporary name doesn't fit, but the path does.
+		// bind it in place, and clients may see the socket file with the default permission for a moment.
+		if p.explicit {
+			return nil, fmt.Errorf("%s: too long to set the permission and the owner before the socket file appears, shorten the path by %d bytes", p.path, len(tmp)-maxUnixPathLen)
+		}
+		s.logf("the path is too long for the temporary name, binding the socket file in place: %s", p.path)
+		return s.listenUnixInPlace(p)
+	}
+	_ = os.Remove(tmp)
+	sock, err := p.listen(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.chmod(tmp); err != nil {
+		sock.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	if stat, err := os.Lstat(p.path); err == nil && stat.Mode()&os.ModeSocket == os.ModeSocket {
+		s.logf("removing existing socket file: %s", p.path)
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		sock.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	return sock, nil
+}
+
+// listenUnixInPlace binds the unix socket at the path, and then sets its permission and owner.
+func (s *Starter) listenUnixInPlace(p *unixPath) (socket, error) {
+	if stat, err := os.Lstat(p.path); err == nil && stat.Mode()&os.ModeSocket == os.ModeSocket {
+		s.logf("removing existing socket file: %s", p.path)
+		if err := os.Remove(p.path); err != nil {
+			return nil, err
+		}
+	}
+	sock, err := p.listen(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.chmod(p.path); err != nil {
+		sock.Close()
+		os.Remove(p.path)
+		return nil, err
+	}
+	return sock, nil
+}
+
+// chmod sets the permission and the owner of the socket file.
+func (p *unixPath) chmod(name string) error {
+	if err := os.Chmod(name, p.mode); err != nil {
+		return err
+	}
+	if p.uid >= 0 || p.gid >= 0 {
+		if err := os.Lchown(name, p.uid, p.gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
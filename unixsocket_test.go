@@ -0,0 +1,148 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseUnixPath(t *testing.T) {
+	uid := strconv.Itoa(os.Getuid())
+	tests := []struct {
+		in   string
+		want unixPath
+	}{
+		{
+			in:   "/tmp/app.sock",
+			want: unixPath{network: "unix", path: "/tmp/app.sock", mode: 0777, uid: -1, gid: -1},
+		},
+		{
+			in:   "/tmp/app.sock?mode=0660",
+			want: unixPath{network: "unix", path: "/tmp/app.sock", mode: 0660, uid: -1, gid: -1, explicit: true},
+		},
+		{
+			in:   "/tmp/app.sock?mode=600&owner=" + uid + "&group=0",
+			want: unixPath{network: "unix", path: "/tmp/app.sock", mode: 0600, uid: os.Getuid(), gid: 0, explicit: true},
+		},
+		{
+			in:   "unixgram:/tmp/log.sock?mode=0660",
+			want: unixPath{network: "unixgram", path: "/tmp/log.sock", mode: 0660, uid: -1, gid: -1, explicit: true},
+		},
+		{
+			in:   "unixpacket:/tmp/app.sock",
+			want: unixPath{network: "unixpacket", path: "/tmp/app.sock", mode: 0777, uid: -1, gid: -1},
+		},
+		{
+			in:   "unix:/tmp/app.sock",
+			want: unixPath{network: "unix", path: "/tmp/app.sock", mode: 0777, uid: -1, gid: -1},
+		},
+		{
+			in:   "/tmp/app?.sock?mode=0600",
+			want: unixPath{network: "unix", path: "/tmp/app?.sock", mode: 0600, uid: -1, gid: -1, explicit: true},
+		},
+		{
+			in:   "/tmp/app?.sock?",
+			want: unixPath{network: "unix", path: "/tmp/app?.sock", mode: 0777, uid: -1, gid: -1},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseUnixPath(tt.in)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: want %#v, got %#v", tt.in, tt.want, *got)
+		}
+	}
+
+	errors := []string{
+		"?mode=0600",
+		"unixgram:",
+		"/tmp/app.sock?mode=0999",
+		"/tmp/app.sock?mode=01777",
+		"/tmp/app.sock?perm=0600",
+		"/tmp/app.sock?owner=no-such-user-server-starter",
+	}
+	for _, in := range errors {
+		if _, err := parseUnixPath(in); err == nil {
+			t.Errorf("%s: want error, got nil", in)
+		}
+	}
+}
+
+func TestParseUnixPath_Abstract(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		if _, err := parseUnixPath("@app.sock"); err == nil {
+			t.Error("want error, got nil")
+		}
+		return
+	}
+
+	got, err := parseUnixPath("@app.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (unixPath{network: "unix", path: "@app.sock", mode: 0777, uid: -1, gid: -1}); *got != want {
+		t.Errorf("want %#v, got %#v", want, *got)
+	}
+	if !got.abstract() {
+		t.Error("want abstract, but not")
+	}
+
+	if _, err := parseUnixPath("@app.sock?mode=0600"); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestListenUnix_LongPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the directory is so long that only a one-letter name fits in sun_path.
+	long := filepath.Join(dir, strings.Repeat("d", maxUnixPathLen-len(dir)-3))
+	if err := os.Mkdir(long, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Starter{}
+	paths := []string{
+		filepath.Join(dir, strings.Repeat("s", maxUnixPathLen-len(dir)-1)),
+		filepath.Join(long, "s"),
+	}
+	for _, path := range paths {
+		if len(path) != maxUnixPathLen {
+			t.Fatalf("%s: want %d bytes, got %d bytes", path, maxUnixPathLen, len(path))
+		}
+		sock, err := s.listenUnix(&unixPath{network: "unix", path: path, mode: 0600, uid: -1, gid: -1})
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		sock.Close()
+		stat, err := os.Lstat(path)
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		if perm := stat.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s: want 0600, got %04o", path, perm)
+		}
+	}
+
+	// binding in place can't keep the permission set by the query, so it fails.
+	path := filepath.Join(long, "e")
+	if _, err := s.listenUnix(&unixPath{network: "unix", path: path, mode: 0600, uid: -1, gid: -1, explicit: true}); err == nil {
+		t.Errorf("%s: want error, got nil", path)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("%s: want no socket file, got %v", path, err)
+	}
+}
@@ -0,0 +1,365 @@
+package starter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// upgradeEnvName is the environment variable that passes the state of start_server
+// to the new start_server in the hot upgrade.
+const upgradeEnvName = "SERVER_STARTER_UPGRADE"
+
+// the maximum time to wait for the new start_server to start its first generation.
+const upgradeTimeout = time.Minute
+
+// upgradeState is the state of start_server passed to the new start_server.
+type upgradeState struct {
+	// the process id of the old start_server.
+	Pid int `json:"pid"`
+
+	// the generation of the newest server process.
+	Generation int `json:"generation"`
+
+	// the listening sockets.
+	Sockets []upgradeSocket `json:"sockets"`
+
+	// the file descriptor of the pid file, or zero if --pid-file is not set.
+	PidFile int `json:"pid_file,omitempty"`
+
+	// the file descriptor of the pipe that the new start_server writes "ready" into.
+	Ready int `json:"ready"`
+}
+
+type upgradeSocket struct {
+	// the --port or --path option that the socket is bound by.
+	Option string `json:"option"`
+
+	FD int `json:"fd"`
+}
+
+// upgrade starts the new binary of start_server and hands over the listening sockets.
+// If the new start_server starts its first generation, the old one stops its server processes and exits.
+func (s *Starter) upgrade() {
+	if s.shutdown.IsSet() {
+		return
+	}
+	if !s.tryToLockReload() {
+		s.logf("failed to upgrade start_server: the server is now reloading, try again later")
+		return
+	}
+	// the server processes that die are restarted while the new start_server is starting.
+	s.handoverPending.Set(true)
+	if err := s.startNewStarter(); err != nil {
+		s.logf("failed to upgrade start_server: %s", err)
+		s.abortHandover()
+		return
+	}
+
+	// the new start_server is now running.
+	// reloading is kept locked, no more worker starts.
+	s.keepPidFile = true
+	s.handOver()
+}
+
+func (s *Starter) startNewStarter() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	state := upgradeState{
+		Pid:        os.Getpid(),
+		Generation: s.generation,
+	}
+
+	s.mu.RLock()
+	sockets := s.listenSockets
+	s.mu.RUnlock()
+
+	// the files in ExtraFiles are the file descriptors 3, 4, 5, ... of the new start_server.
+	var extraFiles []*os.File
+	var files []*os.File // the files that should be closed after the new start_server starts.
+	defer func() {
+		closeFiles(files)
+	}()
+	for _, ls := range sockets {
+		f, err := ls.sock.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		extraFiles = append(extraFiles, f)
+		state.Sockets = append(state.Sockets, upgradeSocket{
+			Option: ls.opt.key(),
+			FD:     len(extraFiles) + 2,
+		})
+	}
+	if s.pidFile != nil {
+		// the lock of the pid file is shared with the new start_server.
+		extraFiles = append(extraFiles, s.pidFile)
+		state.PidFile = len(extraFiles) + 2
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	files = append(files, w)
+	extraFiles = append(extraFiles, w)
+	state.Ready = len(extraFiles) + 2
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = extraFiles
+	cmd.Env = append(os.Environ(), upgradeEnvName+"="+string(data))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	closeFiles(files)
+	files = nil
+	s.logf("upgrading start_server, new start_server %d is starting", cmd.Process.Pid)
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	ready := make(chan bool, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		ready <- line == "ready\n"
+	}()
+
+	timer := time.NewTimer(upgradeTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-ready:
+		if ok {
+			s.logf("new start_server %d is ready", cmd.Process.Pid)
+			return nil
+		}
+		cmd.Process.Signal(syscall.SIGTERM)
+		return fmt.Errorf("new start_server %d exited before it gets ready: %v", cmd.Process.Pid, <-exited)
+	case <-timer.C:
+		cmd.Process.Signal(syscall.SIGTERM)
+		return fmt.Errorf("new start_server %d doesn't get ready in %s", cmd.Process.Pid, upgradeTimeout)
+	case <-s.ctx.Done():
+		cmd.Process.Signal(syscall.SIGTERM)
+		return s.ctx.Err()
+	}
+}
+
+// handOver stops the server processes and exits,
+// leaving the sockets and the pid file to the new start_server.
+func (s *Starter) handOver() {
+	s.handedOver.Set(true)
+	if s.shutdown.TrySet(true) {
+		// wait for a worker that is currently starting
+		ch := s.getChStarter()
+		select {
+		case ch <- struct{}{}:
+		case <-s.ctx.Done():
+			return
+		}
+		defer func() {
+			<-ch
+		}()
+	}
+
+	if delay := s.killOldDelay(); delay > 0 {
+		s.logf("sleeping %d secs before killing old workers", int64(delay/time.Second))
+		time.Sleep(delay)
+	}
+
+	workers := s.listWorkers()
+	var buf strings.Builder
+	for _, w := range workers {
+		buf.WriteByte(',')
+		buf.WriteString(strconv.Itoa(w.Pid()))
+	}
+	if len(workers) == 0 {
+		buf.WriteString(",none")
+	}
+	s.logf("handed over to the new start_server, sending %s to old workers: %s", signalToName(s.signalOnHUP()), buf.String()[1:])
+	for _, w := range workers {
+		w.Signal(s.signalOnHUP(), workerStateOld)
+	}
+	for _, w := range workers {
+		<-w.done
+	}
+	s.Close()
+	s.logf("exiting")
+}
+
+// takeUpgradeState reads the state passed by the old start_server.
+// it returns nil if start_server is not started by the hot upgrade.
+func takeUpgradeState() (*upgradeState, error) {
+	data, ok := os.LookupEnv(upgradeEnvName)
+	if !ok {
+		return nil, nil
+	}
+	// don't pass the state to the server processes and further upgrades.
+	os.Unsetenv(upgradeEnvName)
+
+	var state upgradeState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", upgradeEnvName, err)
+	}
+	return &state, nil
+}
+
+// inheritSockets restores the sockets passed by the old start_server.
+func (s *Starter) inheritSockets(state *upgradeState) error {
+	s.inheritedSockets = make(map[string]socket, len(state.Sockets))
+	for _, us := range state.Sockets {
+		f := os.NewFile(uintptr(us.FD), us.Option)
+		sock, err := fileSocket(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", us.Option, err)
+		}
+		s.inheritedSockets[us.Option] = sock
+	}
+	return nil
+}
+
+func fileSocket(f *os.File) (socket, error) {
+	if l, err := net.FileListener(f); err == nil {
+		if sock, ok := l.(socket); ok {
+			return sock, nil
+		}
+		l.Close()
+		return nil, errors.New("fail to get file description")
+	}
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, err
+	}
+	if sock, ok := conn.(socket); ok {
+		return sock, nil
+	}
+	conn.Close()
+	return nil, errors.New("fail to get file description")
+}
+
+// takeInheritedSocket returns the socket passed by the old start_server, or nil.
+func (s *Starter) takeInheritedSocket(opt listenOption) socket {
+	sock, ok := s.inheritedSockets[opt.key()]
+	if !ok {
+		return nil
+	}
+	delete(s.inheritedSockets, opt.key())
+	return sock
+}
+
+// closeInheritedSockets closes the sockets that are no longer in the configuration.
+func (s *Starter) closeInheritedSockets() {
+	for opt, sock := range s.inheritedSockets {
+		s.logf("closing %s, it is removed from the configuration", opt)
+		sock.Close()
+	}
+	s.inheritedSockets = nil
+}
+
+// takePidFile takes over the pid file locked by the old start_server.
+// the pid file keeps the pid of the old start_server until this start_server gets ready,
+// so --stop, --restart and --upgrade work with the old start_server if this one fails to start.
+func (s *Starter) takePidFile(fd int) error {
+	s.pidFile = os.NewFile(uintptr(fd), s.PidFile)
+	s.pidFileInherited.Set(true)
+	return nil
+}
+
+// writePid rewrites the pid file with the pid of this start_server.
+func (s *Starter) writePid() error {
+	f := s.pidFile
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(f, "%d\n", os.Getpid())
+	return err
+}
+
+// ownInheritedFiles makes this start_server the owner of the socket files and the pid file
+// passed by the old start_server.
+// they are never removed until then, because the old start_server keeps using them if this one fails to start.
+func (s *Starter) ownInheritedFiles() {
+	s.mu.Lock()
+	for _, ls := range s.listenSockets {
+		ls.inherited = false
+	}
+	s.mu.Unlock()
+	if s.pidFileInherited.IsSet() {
+		if err := s.writePid(); err != nil {
+			s.logf("failed to write the pid file: %s", err)
+		}
+		s.pidFileInherited.Set(false)
+	}
+}
+
+// notifyReady tells the old start_server that the first generation is running.
+func (s *Starter) notifyReady(state *upgradeState) {
+	f := os.NewFile(uintptr(state.Ready), "ready")
+	defer f.Close()
+	if _, err := f.Write([]byte("ready\n")); err != nil {
+		s.logf("failed to notify the old start_server: %s", err)
+	}
+}
+
+// upgradeStarter is the wrapper command of --upgrade.
+func (s *Starter) upgradeStarter() error {
+	if s.PidFile == "" || s.UpgradeSignal == nil {
+		return errors.New("--upgrade option requires --pid-file and --upgrade-signal to be set as well")
+	}
+
+	// get pid
+	readPid := func() (int, error) {
+		buf, err := ioutil.ReadFile(s.PidFile)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(string(bytes.TrimSpace(buf)))
+	}
+	pid, err := readPid()
+	if err != nil {
+		return err
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := p.Signal(s.UpgradeSignal); err != nil {
+		return err
+	}
+
+	// wait for the new start_server to take over the pid file.
+	// it writes its pid after it gets ready.
+	deadline := time.Now().Add(upgradeTimeout + 5*time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		newPid, err := readPid()
+		if err == nil && newPid != pid {
+			return nil
+		}
+	}
+	return fmt.Errorf("start_server %d is not upgraded", pid)
+}
@@ -0,0 +1,238 @@
+package starter
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fileStamp is a summary of a file to detect changes.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+	ino     uint64
+}
+
+func newFileStamp(fi os.FileInfo) fileStamp {
+	stamp := fileStamp{
+		size:    fi.Size(),
+		modTime: fi.ModTime(),
+		mode:    fi.Mode(),
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		stamp.ino = uint64(st.Ino)
+	}
+	return stamp
+}
+
+// fileSnapshot is a set of fileStamps.
+type fileSnapshot map[string]fileStamp
+
+// takeSnapshot takes a snapshot of the paths.
+// If the path is a directory, the files in the directory are included.
+// If the path ends with "/...", the files in the directory are included recursively.
+func takeSnapshot(paths []string) fileSnapshot {
+	snapshot := fileSnapshot{}
+	for _, path := range paths {
+		if root := strings.TrimSuffix(path, "/..."); root != path {
+			filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+				if path != root && strings.HasPrefix(fi.Name(), ".") {
+					// skip hidden files and directories, such as .git and swap files of editors.
+					if fi.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				snapshot[path] = newFileStamp(fi)
+				return nil
+			})
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		snapshot[path] = newFileStamp(fi)
+		if !fi.IsDir() {
+			continue
+		}
+		infos, err := readDir(path)
+		if err != nil {
+			continue
+		}
+		for _, fi := range infos {
+			snapshot[filepath.Join(path, fi.Name())] = newFileStamp(fi)
+		}
+	}
+	return snapshot
+}
+
+func readDir(path string) ([]os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdir(-1)
+}
+
+// diff returns the paths that are added, changed or removed.
+func (snapshot fileSnapshot) diff(other fileSnapshot) []string {
+	var changed []string
+	for path, stamp := range snapshot {
+		if stamp2, ok := other[path]; !ok || !stamp.modTime.Equal(stamp2.modTime) || stamp.size != stamp2.size || stamp.mode != stamp2.mode || stamp.ino != stamp2.ino {
+			changed = append(changed, path)
+		}
+	}
+	for path := range other {
+		if _, ok := snapshot[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// watchDirs returns the directories to be watched by the notifier.
+func watchDirs(paths []string) []string {
+	dirs := []string{}
+	for _, path := range paths {
+		if root := strings.TrimSuffix(path, "/..."); root != path {
+			filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+				if err != nil || !fi.IsDir() {
+					return nil
+				}
+				if path != root && strings.HasPrefix(fi.Name(), ".") {
+					return filepath.SkipDir
+				}
+				dirs = append(dirs, path)
+				return nil
+			})
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			dirs = append(dirs, path)
+		}
+
+		// watch the parent directory too, because the file may be replaced by rename(2).
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	return dirs
+}
+
+// watchFiles watches the paths and calls onChange when they are changed.
+// Bursts of changes are debounced, and onChange is not called until the files stop changing for delay.
+// The changes made while onChange is running are ignored, e.g. the outputs of build commands.
+func watchFiles(ctx context.Context, paths []string, delay time.Duration, onChange func(changed []string)) {
+	// use the notifier if available, and fall back to polling.
+	pollInterval := time.Second
+	notify, closeNotifier, err := newNotifier(watchDirs(paths))
+	if err == nil {
+		defer closeNotifier()
+
+		// the notifier may miss the changes in the directories created after start,
+		// so poll slowly as a safety net.
+		pollInterval = 10 * time.Second
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	last := takeSnapshot(paths)
+	for {
+		select {
+		case <-notify:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		current := takeSnapshot(paths)
+		if len(last.diff(current)) == 0 {
+			continue
+		}
+
+		// wait for the files to stop changing,
+		// to avoid reloading while they are still being written.
+		for {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+			next := takeSnapshot(paths)
+			if len(current.diff(next)) == 0 {
+				break
+			}
+			current = next
+		}
+
+		// discard the notifications during the delay.
+		select {
+		case <-notify:
+		default:
+		}
+
+		onChange(last.diff(current))
+		last = takeSnapshot(paths)
+	}
+}
+
+// fileWatcher watches the command and the paths specified by Watch,
+// and reloads the workers if they are changed.
+func (s *Starter) fileWatcher() {
+	paths := append([]string{}, s.Watch...)
+	if command, err := exec.LookPath(s.Command); err == nil {
+		paths = append(paths, command)
+	}
+	watchFiles(s.ctx, paths, s.watchDelay(), func(changed []string) {
+		s.logf("detected changes in %s, spawning a new worker", strings.Join(changed, ", "))
+		s.queueReload()
+	})
+}
+
+// queueReload reloads the workers in background.
+// unlike Reload, it waits for the running reload instead of skipping,
+// so the changes detected during the reload are picked up by the next one.
+// the requests while waiting are merged into one reload.
+func (s *Starter) queueReload() {
+	if !s.reloadQueued.TrySet(true) {
+		return // a reload is already queued
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for !s.tryToLockReload() {
+			select {
+			case <-ticker.C:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		defer s.unlockReload()
+
+		// the changes after here need another reload.
+		s.reloadQueued.Set(false)
+		if err := s.reload(); err != nil {
+			s.logf("failed to reload: %s", err)
+		}
+	}()
+}
+
+func (s *Starter) watchDelay() time.Duration {
+	if s.WatchDelay > 0 {
+		return s.WatchDelay
+	}
+	return time.Second
+}
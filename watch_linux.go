@@ -0,0 +1,48 @@
+package starter
+
+import (
+	"os"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// newNotifier returns a channel that receives a value when the entries in the directories are changed.
+// It uses inotify(7).
+func newNotifier(dirs []string) (<-chan struct{}, func() error, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("inotify_init1", err)
+	}
+	watched := 0
+	for _, dir := range dirs {
+		if _, err := syscall.InotifyAddWatch(fd, dir, inotifyMask); err != nil {
+			continue
+		}
+		watched++
+	}
+	if watched == 0 && len(dirs) > 0 {
+		syscall.Close(fd)
+		return nil, nil, os.NewSyscallError("inotify_add_watch", syscall.ENOENT)
+	}
+
+	// the file descriptor is non-blocking, so the runtime poller is used,
+	// and closing the file unblocks Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	ch := make(chan struct{}, 1)
+	go func() {
+		var buf [syscall.SizeofInotifyEvent * 64]byte
+		for {
+			if _, err := f.Read(buf[:]); err != nil {
+				return
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, f.Close, nil
+}
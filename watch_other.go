@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package starter
+
+import "errors"
+
+// newNotifier is not available on this platform, the callers fall back to polling.
+func newNotifier(dirs []string) (<-chan struct{}, func() error, error) {
+	return nil, nil, errors.New("file notification is not supported on this platform")
+}
@@ -0,0 +1,76 @@
+package starter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-starter-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(file, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan []string, 10)
+	go watchFiles(ctx, []string{file}, 300*time.Millisecond, func(changed []string) {
+		ch <- changed
+	})
+	time.Sleep(100 * time.Millisecond) // wait for starting the watcher
+
+	// burst of changes
+	for i := 0; i < 5; i++ {
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte("more"))
+		f.Close()
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	select {
+	case changed := <-ch:
+		if !reflect.DeepEqual(changed, []string{file}) {
+			t.Errorf("want %v, got %v", []string{file}, changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// the changes are debounced.
+	select {
+	case changed := <-ch:
+		t.Errorf("want no more changes, got %v", changed)
+	case <-time.After(2 * time.Second):
+	}
+
+	// replace the file by rename(2)
+	tmp := filepath.Join(dir, "config.tmp")
+	if err := ioutil.WriteFile(tmp, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case changed := <-ch:
+		if !reflect.DeepEqual(changed, []string{file}) {
+			t.Errorf("want %v, got %v", []string{file}, changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}